@@ -53,25 +53,58 @@ package amt
 
 import (
 	"hash/maphash"
+	"math/bits"
+	"math/rand"
+	"sort"
 	"unsafe"
 )
 
+// Option configures a map or set during initialization.
+type Option uint32
+
+const (
+	// RandomOrder randomizes the iteration order of a map or set for each call to All,
+	// similar to builtin maps. Each iteration starts at a random item within the root
+	// and rotates the order of items within each sub-trie. The layout is not changed.
+	RandomOrder Option = 1 << iota
+	// Recycle retains the link arrays and key-values released when a map or set is cleared,
+	// and reuses them when items are added. Recycling may reduce the load on the garbage
+	// collector when a map or set is repeatedly cleared and rebuilt.
+	Recycle
+	// TotalOrder compares the keys of a Float64Map or Float64Set as a total order, where all NaN
+	// values are a single key. Without TotalOrder, keys are compared as in IEEE 754, and as in
+	// builtin maps, NaN keys never match any key, so each NaN key which is set is a new key.
+	// In both cases negative zero and positive zero are a single key.
+	TotalOrder
+)
+
 // root contains the root level of a map or set. Each root allocation is 512 bytes
 // on 64-bit architectures. Multiples of 64 bytes will likely be 64-byte (cache)
 // aligned by the memory allocator. See runtime/sizeclasses.go.
 type root struct {
 	link
-	seed  maphash.Seed
-	len   uint64
-	dep   uint64
-	_     [3]uint64    // pad to 64-byte alignment
-	items [16]link     // referenced by link
-	path  [12]pathLink // scratch for traversal path during deletion
+	seed   maphash.Seed
+	len    uint64
+	dep    uint64
+	pool   *pool // link arrays and key-values released by clear
+	opts   Option
+	_      uint32         // pad to 64-byte alignment
+	counts *counts        // key counts for random selection, built on first use
+	items  [16]link       // referenced by link
+	path   [11]pathLink   // scratch for traversal path during deletion, extended by append
+	funcs  unsafe.Pointer // *keyFuncs[K] of a FuncMap or FuncSet
+	_      uint64         // pad to 512 bytes
 }
 
-func newRoot() *root {
+func newRoot(opts ...Option) *root {
 	r := &root{seed: maphash.MakeSeed()}
 	r.link.ptr = unsafe.Pointer(&r.items)
+	for _, opt := range opts {
+		r.opts |= opt
+	}
+	if r.opts&Recycle != 0 {
+		r.pool = new(pool)
+	}
 	return r
 }
 
@@ -91,6 +124,506 @@ func (r *root) Dep() float64 {
 	return float64(r.dep) / float64(r.len)
 }
 
+// added increments the length of r for a key added with the initial hash h.
+func (r *root) added(h uint64) {
+	r.len++
+	if r.counts != nil {
+		r.counts.add(h, 1)
+	}
+}
+
+// removed decrements the length of r for a key removed with the initial hash h.
+func (r *root) removed(h uint64) {
+	r.len--
+	if r.counts != nil {
+		r.counts.add(h, ^uint64(0))
+	}
+}
+
+// order returns the rotation applied to the iteration order of items in r. The rotation
+// is zero unless r was initialized with the RandomOrder option. Each scan starts at the
+// first item at or after the radix in the low 4 bits of the rotation, and passes the
+// rotation right-rotated by 4 bits to each sub-trie.
+func (r *root) order() uint64 {
+	if r.opts&RandomOrder == 0 {
+		return 0
+	}
+	return rand.Uint64()
+}
+
+// clear removes all items from r, retaining the seed and options of r. If r was initialized
+// with the Recycle option, link arrays and key-values are released to the pool of r. The zero
+// callback must reset the key-value at each released pointer to its zero value.
+func (r *root) clear(zero func(unsafe.Pointer)) {
+	if r.pool != nil {
+		r.pool.release(&r.link, zero)
+	}
+	r.items = [16]link{}
+	r.pmap, r.tmap = 0, 0
+	r.len, r.dep = 0, 0
+	r.counts = nil
+}
+
+// retain removes the key-values within the sub-trie at l for which the keep callback returns
+// false, where the items of l are at depth d. Items are shifted back within each link array,
+// and a link array is reallocated when its capacity may be reduced by a multiple of 4 links.
+// Empty branches are removed, and branches with a single key-value are replaced with the
+// key-value, as in deletion.
+func (r *root) retain(l *link, d uint8, keep func(*link) bool) {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	kept := uint8(0)
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		pmap &^= bit
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		if tmap&bit != 0 { // key-value
+			if !keep(item) {
+				l.pmap &^= bit
+				l.tmap &^= bit
+				r.len--
+				r.dep -= uint64(d)
+				r.counts = nil // rebuilt by the next random selection
+				continue
+			}
+		} else { // branch
+			r.retain(item, d+1, keep)
+			switch n := bits.OnesCount32(item.pmap); {
+			case n == 0: // unlink empty branch
+				l.pmap &^= bit
+				continue
+			case n == 1 && item.pmap == item.tmap: // replace single-valued branch with key-value
+				*item = *(*link)(item.ptr)
+				l.tmap |= bit
+				r.dep--
+			}
+		}
+		if kept != i {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(kept)*linkSize)) = *item
+		}
+		kept++
+	}
+	if kept == count {
+		return
+	}
+	if d != 0 && (kept == 0 || linkArrayClass(kept) < linkArrayClass(count)) { // reallocate
+		src := l.ptr
+		l.ptr = nil
+		if kept != 0 {
+			l.ptr = r.newLinkArray(kept)
+		}
+		for i := uint8(0); i < kept; i++ {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize)) =
+				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(i)*linkSize))
+		}
+		return
+	}
+	// clear shifted items to prevent leaks
+	for i := kept; i < count; i++ {
+		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize)) = link{}
+	}
+}
+
+// splitRoot moves the key-values within r into two new roots with the seed, key functions, and
+// options of r: match for the key-values for which the keep callback returns true, and rest for
+// all others. Sub-tries are moved as in split, and r is left empty. r is consumed so that copies
+// of a map or set sharing r do not silently become match.
+func (r *root) splitRoot(keep func(*link) bool) (match, rest *root) {
+	rest = newRoot(r.opts)
+	rest.seed, rest.funcs = r.seed, r.funcs
+	r.split(&r.link, &rest.link, 0, rest, keep)
+	match = newRoot(r.opts)
+	match.seed, match.funcs = r.seed, r.funcs
+	match.items, match.pmap, match.tmap = r.items, r.pmap, r.tmap
+	match.len, match.dep = r.len, r.dep
+	r.items = [16]link{}
+	r.pmap, r.tmap = 0, 0
+	r.len, r.dep = 0, 0
+	r.counts = nil
+	return match, rest
+}
+
+// split moves the key-values within the sub-trie at l for which the keep callback returns
+// false into the empty sub-trie at dst within rest, where the items of l and dst are at depth d.
+// Both sub-tries retain the canonical layout for their seed, as in retain. A link array is moved
+// from l to dst without copying when none of its key-values are kept.
+func (r *root) split(l, dst *link, d uint8, rest *root, keep func(*link) bool) {
+	var moved [16]link
+	var mpmap, mtmap uint32
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	kept, nmoved := uint8(0), uint8(0)
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		pmap &^= bit
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		if tmap&bit != 0 { // key-value
+			if !keep(item) {
+				moved[nmoved] = *item
+				nmoved++
+				mpmap |= bit
+				mtmap |= bit
+				l.pmap &^= bit
+				l.tmap &^= bit
+				r.len--
+				r.dep -= uint64(d)
+				r.counts = nil // rebuilt by the next random selection
+				rest.len++
+				rest.dep += uint64(d)
+				continue
+			}
+		} else { // branch
+			var sub link
+			r.split(item, &sub, d+1, rest, keep)
+			switch n := bits.OnesCount32(sub.pmap); {
+			case n == 0: // nothing moved
+			case n == 1 && sub.pmap == sub.tmap: // replace single-valued branch with key-value
+				moved[nmoved] = *(*link)(sub.ptr)
+				nmoved++
+				mpmap |= bit
+				mtmap |= bit
+				rest.dep--
+			default:
+				moved[nmoved] = sub
+				nmoved++
+				mpmap |= bit
+			}
+			switch n := bits.OnesCount32(item.pmap); {
+			case n == 0: // unlink empty branch
+				l.pmap &^= bit
+				continue
+			case n == 1 && item.pmap == item.tmap: // replace single-valued branch with key-value
+				*item = *(*link)(item.ptr)
+				l.tmap |= bit
+				r.dep--
+			}
+		}
+		if kept != i {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(kept)*linkSize)) = *item
+		}
+		kept++
+	}
+	if nmoved == 0 {
+		return
+	}
+	dst.pmap, dst.tmap = mpmap, mtmap
+	if d != 0 && kept == 0 { // move the link array of l
+		dst.ptr, l.ptr = l.ptr, nil
+	} else {
+		if d != 0 {
+			dst.ptr = rest.newLinkArray(nmoved)
+		}
+		if d != 0 && linkArrayClass(kept) < linkArrayClass(count) { // reallocate
+			src := l.ptr
+			l.ptr = r.newLinkArray(kept)
+			for i := uint8(0); i < kept; i++ {
+				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize)) =
+					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(i)*linkSize))
+			}
+		} else { // clear shifted items to prevent leaks
+			for i := kept; i < count; i++ {
+				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize)) = link{}
+			}
+		}
+	}
+	for i := uint8(0); i < nmoved; i++ {
+		*(*link)(unsafe.Pointer(uintptr(dst.ptr) + uintptr(i)*linkSize)) = moved[i]
+	}
+}
+
+// popAny removes the first key-value within r, returning its link and true if r was not empty.
+// The hash callback must return the initial hash of the key within a key-value link.
+func (r *root) popAny(hash func(*link) uint64) (kv link, ok bool) {
+	if r.pmap == 0 {
+		return link{}, false
+	}
+	path := r.path[:0]
+	l, d := &r.link, uint8(0)
+	radix := uint8(bits.TrailingZeros32(l.pmap))
+	for l.tmap&(1<<radix) == 0 { // traverse branch
+		path = append(path, pathLink{radix, l})
+		l = (*link)(l.ptr)
+		d++
+		radix = uint8(bits.TrailingZeros32(l.pmap))
+	}
+	path = append(path, pathLink{radix, l})
+	kv = *(*link)(l.ptr)
+	var h uint64
+	if r.counts != nil {
+		h = hash(&kv)
+	}
+	r.unlink(path, d, h)
+	return kv, true
+}
+
+// unlink removes the key-value at the last link of path, where path contains the links and
+// radixes traversed from the root to depth d, and h is the initial hash of its key. Empty branches
+// are unlinked and single-valued branches are replaced with key-values up to the root, and path
+// is cleared. It returns the depth of the deepest link within path which was not unlinked or replaced.
+func (r *root) unlink(path []pathLink, d uint8, h uint64) uint8 {
+	l, radix := path[d].link, path[d].radix
+	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
+	l.pmap &^= bit
+	l.tmap &^= bit
+	r.removed(h)
+	r.dep -= uint64(d)
+	path[d].link = nil
+	count := uint8(bits.OnesCount32(l.pmap))
+	// unlink empty branches up to the root
+	for count == 0 && d != 0 {
+		l.ptr = nil
+		d--
+		l, radix = path[d].link, path[d].radix
+		path[d].link = nil
+		bit, idx = 1<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
+		l.pmap &^= bit
+		l.tmap &^= bit
+		count = uint8(bits.OnesCount32(l.pmap))
+	}
+	// shift items back
+	src := l.ptr
+	if count%4 == 0 && d != 0 { // copy all items when reallocating
+		l.ptr = r.newLinkArray(count)
+		for before := uint8(0); before < idx; before++ {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
+				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
+		}
+	}
+	for after := idx; after < count; after++ {
+		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize)) =
+			*(*link)(unsafe.Pointer(uintptr(src) + uintptr(after+1)*linkSize))
+	}
+	// replace single-valued branches with key-values up to the root
+	for count == 1 && l.pmap == l.tmap && d != 0 {
+		*l = *(*link)(l.ptr)
+		r.dep--
+		d--
+		l, radix = path[d].link, path[d].radix
+		path[d].link = nil
+		l.tmap |= 1 << radix
+		count = uint8(bits.OnesCount32(l.pmap))
+	}
+	// clear the path to prevent leaks
+	for i := d; i != 0; {
+		i--
+		path[i].link = nil
+	}
+	return d
+}
+
+// insertItem inserts the key-value link kv into l at radix, where the items of l are at depth d,
+// radix is not present in l, and h is the initial hash of the key. It returns the inserted link.
+func (r *root) insertItem(l *link, d, radix uint8, h uint64, kv link) *link {
+	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
+	count := uint8(bits.OnesCount32(l.pmap))
+	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
+		for after := int(count) - 1; after >= int(idx); after-- {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
+				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
+		}
+	} else { // array full or empty
+		src := l.ptr
+		l.ptr = r.newLinkArray(count + 1)
+		for before := uint8(0); before < idx; before++ {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
+				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
+		}
+		for after := idx; after < count; after++ {
+			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
+				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(after)*linkSize))
+		}
+	}
+	item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
+	*item = kv
+	l.pmap |= bit
+	l.tmap |= bit
+	r.added(h)
+	r.dep += uint64(d)
+	return item
+}
+
+// branchItems replaces the conflicting key-value at item, at depth d within l at radix, with
+// new branches until the hashes of its key and the key of kv diverge. The h hash is the initial
+// hash of the key of kv, the hd and chd hashes contain the remaining bits for the keys of kv and
+// item at depth d, and the rehash callback must return the next hashes of both keys. It returns
+// the inserted link.
+func (r *root) branchItems(l, item *link, d, radix uint8, h, hd, chd uint64, rehash func() (uint64, uint64), kv link) *link {
+	ckv := *item
+	l.tmap &^= 1 << radix
+	r.dep -= uint64(d) // conflicting key depth
+	for {
+		d++
+		if d%(64/4) != 0 { // hash bits available
+			hd >>= 4
+			chd >>= 4
+		} else { // rehash keys
+			hd, chd = rehash()
+		}
+		kbit, cbit := uint32(1)<<uint8(hd&0xF), uint32(1)<<uint8(chd&0xF)
+		if kbit != cbit { // non-colliding
+			*item = link{ptr: r.newLinkArray(2), pmap: kbit | cbit, tmap: kbit | cbit}
+			r.added(h)
+			r.dep += uint64(d) * 2
+			pair := (*[2]link)(item.ptr)
+			if kbit < cbit {
+				pair[0], pair[1] = kv, ckv
+				return &pair[0]
+			}
+			pair[0], pair[1] = ckv, kv
+			return &pair[1]
+		}
+		// handle collision at new level
+		*item = link{ptr: r.newLinkArray(1), pmap: kbit}
+		item = (*link)(item.ptr)
+	}
+}
+
+// cloneRoot returns a new root with the seed, key functions, options, and trie layout of r. The
+// item callback must initialize each key-value link in the new root from the corresponding link
+// in r.
+func (r *root) cloneRoot(item func(dst, src *link)) *root {
+	c := newRoot(r.opts)
+	c.seed, c.funcs = r.seed, r.funcs
+	cloneItems(&c.link, &r.link, item)
+	c.len, c.dep = r.len, r.dep
+	return c
+}
+
+// cloneItems copies the bitmaps of src and each of its items into dst, allocating a link array
+// for each sub-trie. The item callback must initialize each key-value link in dst from src.
+func cloneItems(dst, src *link, item func(dst, src *link)) {
+	pmap, tmap := src.pmap, src.tmap
+	dst.pmap, dst.tmap = pmap, tmap
+	count := uint8(bits.OnesCount32(pmap))
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		s := (*link)(unsafe.Pointer(uintptr(src.ptr) + uintptr(i)*linkSize))
+		d := (*link)(unsafe.Pointer(uintptr(dst.ptr) + uintptr(i)*linkSize))
+		if tmap&bit != 0 {
+			item(d, s)
+		} else {
+			d.ptr = newLinkArray(uint8(bits.OnesCount32(s.pmap)))
+			cloneItems(d, s, item)
+		}
+		pmap &^= bit
+	}
+}
+
+// newLinkArray allocates an array of 4, 8, 12, or 16 links, reusing a released array
+// if one is available.
+func (r *root) newLinkArray(capacity uint8) unsafe.Pointer {
+	if r.pool == nil {
+		return newLinkArray(capacity)
+	}
+	return r.pool.newLinkArray(capacity)
+}
+
+// newItem allocates a key-value initialized to item, reusing a released key-value
+// if one is available.
+func newItem[T any](r *root, item T) *T {
+	var p *T
+	if r.pool != nil {
+		p = (*T)(r.pool.newItem())
+	}
+	if p == nil {
+		p = new(T)
+	}
+	*p = item
+	return p
+}
+
+// reserveBlock is the maximum number of key-values allocated together by reserveItems. Each block
+// is retained while any of its key-values remain in use, so blocks are kept small.
+const reserveBlock = 64
+
+// reserveItems preallocates n key-values of type T in blocks of up to reserveBlock, which are used
+// by subsequent calls to newItem until they are exhausted or the reservation is dropped.
+func reserveItems[T any](r *root, n int) {
+	if n <= 0 {
+		return
+	}
+	if r.pool == nil {
+		r.pool = new(pool)
+	}
+	for n > 0 {
+		size := (n-1)%reserveBlock + 1
+		block := make([]T, size)
+		for i := size - 1; i >= 0; i-- { // items are taken from the end of the pool
+			r.pool.items = append(r.pool.items, unsafe.Pointer(&block[i]))
+		}
+		n -= size
+	}
+}
+
+// dropReserved drops any unused key-values reserved by reserveItems, unless r recycles
+// key-values released when cleared.
+func (r *root) dropReserved() {
+	if r.opts&Recycle == 0 {
+		r.pool = nil
+	}
+}
+
+// pool contains link arrays and key-values released when a map or set is cleared.
+// Each root has its own pool, so all key-values within a pool have the same type.
+type pool struct {
+	arrays [4][]unsafe.Pointer // *[4|8|12|16]link
+	items  []unsafe.Pointer
+}
+
+func (p *pool) newLinkArray(capacity uint8) unsafe.Pointer {
+	class := linkArrayClass(capacity)
+	arrays := p.arrays[class]
+	if len(arrays) == 0 {
+		return newLinkArray(capacity)
+	}
+	array := arrays[len(arrays)-1]
+	arrays[len(arrays)-1] = nil
+	p.arrays[class] = arrays[:len(arrays)-1]
+	return array
+}
+
+func (p *pool) newItem() unsafe.Pointer {
+	if len(p.items) == 0 {
+		return nil
+	}
+	item := p.items[len(p.items)-1]
+	p.items[len(p.items)-1] = nil
+	p.items = p.items[:len(p.items)-1]
+	return item
+}
+
+// release adds the link arrays and key-values within the sub-trie at l to p, excluding the
+// link array of l. Released link arrays are zeroed, and the zero callback is applied to each
+// released key-value. If the zero callback is nil, leaf pointers are not released.
+func (p *pool) release(l *link, zero func(unsafe.Pointer)) {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		if tmap&bit == 0 {
+			p.release(item, zero)
+			// the capacity of each link array is the count of its items rounded up to a multiple of 4
+			class := linkArrayClass(uint8(bits.OnesCount32(item.pmap)))
+			switch class {
+			case 0:
+				*(*[4]link)(item.ptr) = [4]link{}
+			case 1:
+				*(*[8]link)(item.ptr) = [8]link{}
+			case 2:
+				*(*[12]link)(item.ptr) = [12]link{}
+			default:
+				*(*[16]link)(item.ptr) = [16]link{}
+			}
+			p.arrays[class] = append(p.arrays[class], item.ptr)
+		} else if zero != nil { // keys stored inline without key-values are not released
+			zero(item.ptr)
+			p.items = append(p.items, item.ptr)
+		}
+		pmap &^= bit
+	}
+}
+
 // link is an Array Mapped Trie (AMT) level with up to 16 items or a key-value
 // pointer within a level.
 //
@@ -130,6 +663,695 @@ func newLinkArray(capacity uint8) unsafe.Pointer {
 	}
 }
 
+// scanItems applies the do callback to each key-value link within the sub-trie at l until
+// the callback returns false or all links have been visited.
+func scanItems(l *link, do func(*link) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		if tmap&bit != 0 {
+			if !do(item) {
+				return false
+			}
+		} else if !scanItems(item, do) {
+			return false
+		}
+		pmap &^= bit
+	}
+	return true
+}
+
+const (
+	sortedRun = 256 // maximum number of key-values within the sub-trie of a sorted cursor
+	sortedBuf = 32  // number of key-values buffered by a sorted cursor
+)
+
+// sortedScan applies the do callback to each key-value link within the sub-trie at l, which
+// contains n key-values, in ascending order of keys as determined by the cmp callback, until
+// the do callback returns false or all links have been visited. Keys are not ordered within a
+// trie, so the key-values of each sub-trie with at most sortedRun key-values are ordered by a
+// cursor, and cursors are merged through a heap. Each cursor buffers its next sortedBuf
+// key-values, and scans its sub-trie again when its buffer is exhausted. Memory is used for the
+// cursors rather than for each of the n key-values, and key-values are not sorted before the
+// first link is visited. Keys which are equal according to cmp are visited in a fixed order.
+func sortedScan(l *link, n uint64, cmp func(a, b *link) int, do func(*link) bool) {
+	s := sortedMerge{cmp: cmp}
+	s.addCursors(l, n)
+	s.heap = make([]*sortedCursor, len(s.cursors))
+	for i := range s.cursors {
+		s.heap[i] = &s.cursors[i]
+	}
+	for i := len(s.heap)/2 - 1; i >= 0; i-- {
+		s.down(i)
+	}
+	for len(s.heap) != 0 {
+		c := s.heap[0]
+		if !do(c.buf[c.i].item) {
+			return
+		}
+		if !c.advance(cmp) { // remove exhausted cursor
+			last := len(s.heap) - 1
+			s.heap[0], s.heap[last] = s.heap[last], nil
+			s.heap = s.heap[:last]
+			if last == 0 {
+				return
+			}
+		}
+		s.down(0)
+	}
+}
+
+// sortedMerge is a min-heap of cursors, ordered by the current key-value of each cursor.
+type sortedMerge struct {
+	cmp     func(a, b *link) int
+	cursors []sortedCursor
+	heap    []*sortedCursor // within cursors
+}
+
+// addCursors adds cursors for the key-values within the sub-trie at l, which contains n
+// key-values, splitting sub-tries with more than sortedRun key-values.
+func (s *sortedMerge) addCursors(l *link, n uint64) {
+	if n <= sortedRun {
+		if n > sortedBuf {
+			n = sortedBuf
+		}
+		s.add(sortedCursor{l: l, buf: make([]sortedItem, n)})
+		return
+	}
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		if tmap&bit != 0 {
+			s.add(sortedCursor{l: item, kv: true})
+		} else {
+			s.addCursors(item, countItems(item))
+		}
+		pmap &^= bit
+	}
+}
+
+// add advances c to its first key-value and adds c to s, unless c is empty.
+func (s *sortedMerge) add(c sortedCursor) {
+	c.ord = len(s.cursors)
+	if c.advance(s.cmp) {
+		s.cursors = append(s.cursors, c)
+	}
+}
+
+// less orders cursors by their current key-values, then by the order in which they were added.
+func (s *sortedMerge) less(x, y *sortedCursor) bool {
+	r := s.cmp(x.buf[x.i].item, y.buf[y.i].item)
+	return r < 0 || (r == 0 && x.ord < y.ord)
+}
+
+// down restores the order of the heap below i after the cursor at i is advanced. The cursor is
+// moved to a leaf along the least children, then up to its position, which takes fewer
+// comparisons than sifting down when the cursor is likely to be moved near the leaves.
+func (s *sortedMerge) down(i int) {
+	c, j := s.heap[i], i
+	for {
+		child := 2*j + 1
+		if child >= len(s.heap) {
+			break
+		}
+		if right := child + 1; right < len(s.heap) && s.less(s.heap[right], s.heap[child]) {
+			child = right
+		}
+		s.heap[j] = s.heap[child]
+		j = child
+	}
+	for j > i {
+		parent := (j - 1) / 2
+		if !s.less(c, s.heap[parent]) {
+			break
+		}
+		s.heap[j] = s.heap[parent]
+		j = parent
+	}
+	s.heap[j] = c
+}
+
+// sortedCursor orders the key-values within a sub-trie by key, then by their index within a
+// scan of the sub-trie.
+type sortedCursor struct {
+	l    *link                  // sub-trie or key-value
+	kv   bool                   // l is a key-value
+	n, i uint8                  // number of buffered key-values, and index of the current key-value
+	ord  int                    // order in which the cursor was added to a merge
+	used [sortedRun / 64]uint64 // scan indexes of the key-values buffered by previous scans
+	buf  []sortedItem           // up to sortedBuf key-values, or the key-value l
+}
+
+// sortedItem is a key-value link and its index within a scan of the sub-trie of a cursor.
+type sortedItem struct {
+	item *link
+	idx  int
+}
+
+// after returns true if x follows y in the order of a cursor.
+func (x sortedItem) after(y sortedItem, cmp func(a, b *link) int) bool {
+	r := cmp(x.item, y.item)
+	return r > 0 || (r == 0 && x.idx > y.idx)
+}
+
+// advance moves c to its next key-value, returning false if c is exhausted. When the buffer
+// of c is exhausted, the sub-trie of c is scanned again for the least key-values which were
+// not buffered by previous scans.
+func (c *sortedCursor) advance(cmp func(a, b *link) int) bool {
+	if c.i+1 < c.n {
+		c.i++
+		return true
+	}
+	if c.kv {
+		if c.n != 0 {
+			return false
+		}
+		c.buf, c.n = []sortedItem{{item: c.l}}, 1
+		return true
+	}
+	if c.n != 0 && c.n < sortedBuf { // the last scan buffered all remaining key-values
+		return false
+	}
+	c.n, c.i = 0, 0
+	idx := 0
+	c.fill(c.l, &idx, cmp)
+	for _, x := range c.buf[:c.n] {
+		c.used[x.idx/64] |= 1 << (x.idx % 64)
+	}
+	return c.n != 0
+}
+
+// fill buffers the least key-values within the sub-trie at l which were not buffered by
+// previous scans. The idx counter is the scan index of the next key-value.
+func (c *sortedCursor) fill(l *link, idx *int, cmp func(a, b *link) int) {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	for i := uint8(0); i < count; i++ {
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		pmap &^= bit
+		if tmap&bit == 0 {
+			c.fill(item, idx, cmp)
+			continue
+		}
+		x := sortedItem{item, *idx}
+		*idx++
+		if c.used[x.idx/64]&(1<<(x.idx%64)) != 0 {
+			continue
+		}
+		if int(c.n) == len(c.buf) && !c.buf[c.n-1].after(x, cmp) {
+			continue
+		}
+		// insert x in order, dropping the greatest buffered key-value if the buffer is full
+		j := c.n
+		if int(j) == len(c.buf) {
+			j--
+		} else {
+			c.n++
+		}
+		for ; j > 0 && c.buf[j-1].after(x, cmp); j-- {
+			c.buf[j] = c.buf[j-1]
+		}
+		c.buf[j] = x
+	}
+}
+
+// counts contains the number of keys within a map or set for each prefix of their initial
+// hashes, up to a few radixes. The prefixes of the initial hash of a key are the radixes of its
+// path through the first levels of the trie, so the counts of the prefixes along a path are the
+// counts of key-values within the sub-tries along the path. Counts are built by the first random
+// selection from a map or set, then maintained as keys are added or removed.
+type counts struct {
+	levels [][]uint64 // the count for a prefix p of i+1 radixes is at levels[i][p]
+}
+
+// countRadixes returns the number of radixes counted for n keys, such that the sub-trie for
+// each prefix contains 16 to 256 key-values on average.
+func countRadixes(n uint64) int {
+	if k := (bits.Len64(n)-1)/4 - 1; k > 1 {
+		return k
+	}
+	return 1
+}
+
+// add adds delta to the count of each prefix of the initial hash h.
+func (c *counts) add(h, delta uint64) {
+	for i, level := range c.levels {
+		level[h&(1<<(4*(i+1))-1)] += delta
+	}
+}
+
+// countKeys returns the counts of r, counting the keys within r if the counts were not built or
+// the length of r has changed by more than a factor of 16 since they were built. The hash callback
+// must return the initial hash of the key within a key-value link.
+func (r *root) countKeys(hash func(*link) uint64) *counts {
+	k := countRadixes(r.len)
+	if c := r.counts; c != nil && len(c.levels) >= k && len(c.levels) <= k+1 {
+		return c
+	}
+	c := &counts{levels: make([][]uint64, k)}
+	for i := range c.levels {
+		c.levels[i] = make([]uint64, 1<<(4*(i+1)))
+	}
+	scanItems(&r.link, func(item *link) bool {
+		c.add(hash(item), 1)
+		return true
+	})
+	r.counts = c
+	return c
+}
+
+// errCounts is raised when the key counts of a root do not match the keys within the root,
+// which may only happen if the root was modified concurrently.
+const errCounts = "amt: key counts do not match the keys of the map or set"
+
+// selectItem returns a uniformly random key-value link within r, the links and radixes traversed
+// from the root to the key-value within the path scratch of r, and the counted prefix of the
+// initial hash of its key; or nil if r is empty. A random index is found within the counts of a
+// prefix by descending the counts of r, then the trie is descended along the prefix to the
+// key-value at the index within the sub-trie of the prefix, counting the key-values within each
+// sub-trie passed over below the counted levels. The hash callback must return the initial hash
+// of the key within a key-value link. If rng is nil, the default source of math/rand is used.
+// selectItem panics if the counts of r do not match the keys within r.
+func (r *root) selectItem(rng *rand.Rand, hash func(*link) uint64) (item *link, path []pathLink, h uint64) {
+	if r.len == 0 {
+		return nil, nil, 0
+	}
+	c := r.countKeys(hash)
+	n := uint64(randn(rng, int64(r.len)))
+	for i, level := range c.levels {
+		radix := uint64(0)
+		for ; radix < 16; radix++ {
+			count := level[h|radix<<(4*i)]
+			if n < count {
+				break
+			}
+			n -= count
+		}
+		if radix == 16 {
+			panic(errCounts)
+		}
+		h |= radix << (4 * i)
+	}
+	path = r.path[:0]
+	l := &r.link
+	for i := range c.levels { // descend the prefix
+		radix := uint8(h>>(4*i)) & 0xF
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 {
+			panic(errCounts)
+		}
+		path = append(path, pathLink{radix, l})
+		item = (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 { // the only key-value with the prefix
+			return item, path, h
+		}
+		l = item
+	}
+	for { // descend the sub-trie of the prefix
+		pmap := l.pmap
+		for {
+			if pmap == 0 {
+				panic(errCounts)
+			}
+			radix := uint8(bits.TrailingZeros32(pmap))
+			bit := uint32(1) << radix
+			item = (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+			if l.tmap&bit != 0 {
+				if n == 0 {
+					return item, append(path, pathLink{radix, l}), h
+				}
+				n--
+			} else if count := countItems(item); n < count {
+				path = append(path, pathLink{radix, l})
+				l = item
+				break
+			} else {
+				n -= count
+			}
+			pmap &^= bit
+		}
+	}
+}
+
+// countItems returns the number of key-values within the sub-trie at l.
+func countItems(l *link) (n uint64) {
+	scanItems(l, func(*link) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// randomItem returns a uniformly random key-value link within r, or nil if r is empty. See
+// selectItem. After the keys within r are counted by the first selection, the expected time to
+// select a key-value is proportional to the length of r divided by 16^k for k counted levels,
+// since the sub-tries below the counted levels are counted by scanning them.
+func (r *root) randomItem(rng *rand.Rand, hash func(*link) uint64) *link {
+	item, path, _ := r.selectItem(rng, hash)
+	for i := range path { // clear the path to prevent leaks
+		path[i].link = nil
+	}
+	return item
+}
+
+// popRandom removes a uniformly random key-value from r, returning its link and true if r was
+// not empty. The key-value is unlinked through the path traversed by selectItem.
+func (r *root) popRandom(rng *rand.Rand, hash func(*link) uint64) (kv link, ok bool) {
+	item, path, h := r.selectItem(rng, hash)
+	if item == nil {
+		return link{}, false
+	}
+	kv = *item
+	r.unlink(path, uint8(len(path)-1), h) // the counted prefix of the hash is sufficient
+	return kv, true
+}
+
+// sample returns up to n distinct key-value links within r, chosen uniformly at random. If n is
+// at most half the length of r, key-values are selected as in randomItem and repeated key-values
+// are rejected. Otherwise r is scanned once. If rng is nil, the default source of math/rand is used.
+func (r *root) sample(n int, rng *rand.Rand, hash func(*link) uint64) []link {
+	if uint64(n) > r.len {
+		n = int(r.len)
+	}
+	if n <= 0 {
+		return nil
+	}
+	items := make([]link, 0, n)
+	if uint64(n) <= r.len/2 {
+		seen := make(map[*link]struct{}, n)
+		for len(items) < n {
+			item := r.randomItem(rng, hash)
+			if _, ok := seen[item]; !ok {
+				seen[item] = struct{}{}
+				items = append(items, *item)
+			}
+		}
+		return items
+	}
+	i := int64(0)
+	scanItems(&r.link, func(l *link) bool {
+		if len(items) < n {
+			items = append(items, *l)
+		} else if j := randn(rng, i+1); j < int64(n) {
+			items[j] = *l
+		}
+		i++
+		return true
+	})
+	return items
+}
+
+func randn(rng *rand.Rand, n int64) int64 {
+	if rng == nil {
+		return rand.Int63n(n)
+	}
+	return rng.Int63n(n)
+}
+
+// part is a view of the items within a contiguous range of hash prefixes in a map or set.
+// The hash prefix of a key is its initial hash with the radix of the root level as the most
+// significant 4 bits, followed by the radix of each sub-trie level; see hashPath. Each key is
+// within the part containing its own prefix, regardless of the depth of its key-value. If
+// fixed is set, the range is of the hash callback itself, which need not follow the layout.
+type part struct {
+	r      *root
+	hash   func(*link) uint64 // initial hash of the key within a key-value link
+	lo, hi uint64             // inclusive range of hash prefixes
+	len    uint
+	fixed  bool // range of hash results, independent of the seed and layout of r
+}
+
+// partition splits the hash prefixes in r into n ranges of equal size. The hash callback must
+// return the initial hash of the key within a key-value link.
+func partition[P any](r *root, n uint, hash func(*link) uint64, view func(part) P) []P {
+	return partitionRanges(r, n, hash, false, view)
+}
+
+// partitionFunc splits the results of the hash callback for the keys in r into n ranges of
+// equal size. The hash callback may return any hash of the key within a key-value link, so
+// each part scans all of r.
+func partitionFunc[P any](r *root, n uint, hash func(*link) uint64, view func(part) P) []P {
+	return partitionRanges(r, n, hash, true, view)
+}
+
+func partitionRanges[P any](r *root, n uint, hash func(*link) uint64, fixed bool, view func(part) P) []P {
+	parts := make([]P, n)
+	for i := uint(0); i < n; i++ {
+		p := part{r: r, hash: hash, hi: ^uint64(0), fixed: fixed}
+		p.lo, _ = bits.Div64(uint64(i), 0, uint64(n))
+		if i+1 < n {
+			p.hi, _ = bits.Div64(uint64(i+1), 0, uint64(n))
+			p.hi--
+		}
+		p.scan(func(*link) bool {
+			p.len++
+			return true
+		})
+		parts[i] = view(p)
+	}
+	return parts
+}
+
+// Len returns the number of values or keys within the partition.
+func (p part) Len() uint { return p.len }
+
+// scan applies the do callback to each key-value link within p until the callback returns
+// false or all links have been visited.
+func (p part) scan(do func(*link) bool) {
+	if p.fixed {
+		scanItems(&p.r.link, func(item *link) bool {
+			if h := p.hash(item); h < p.lo || h > p.hi {
+				return true
+			}
+			return do(item)
+		})
+		return
+	}
+	p.partScan(&p.r.link, 0, 0, do)
+}
+
+// partScan applies the do callback to each key-value link within the sub-trie at l, at depth d
+// with the hash prefix prefix, whose key has a hash prefix within p. A key-value whose slot
+// straddles a bound of p is within p if the prefix of its own hash is, so its key is rehashed;
+// this happens for at most one key-value per bound at each level.
+func (p part) partScan(l *link, d uint8, prefix uint64, do func(*link) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	shift := 60 - 4*d
+	for i := uint8(0); i < count; i++ {
+		radix := uint8(bits.TrailingZeros32(pmap))
+		bit := uint32(1) << radix
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		start := prefix | uint64(radix)<<shift
+		end := start | (uint64(1)<<shift - 1)
+		switch {
+		case start > p.hi:
+			return true // remaining items are out of range
+		case end < p.lo: // out of range
+		case start >= p.lo && end <= p.hi: // item within range
+			if tmap&bit != 0 {
+				if !do(item) {
+					return false
+				}
+			} else if !scanItems(item, do) {
+				return false
+			}
+		case tmap&bit != 0: // key-value straddles a bound
+			if h := hashPath(p.hash(item)); h >= p.lo && h <= p.hi && !do(item) {
+				return false
+			}
+		default: // sub-trie overlaps range
+			if !p.partScan(item, d+1, start, do) {
+				return false
+			}
+		}
+		pmap &^= bit
+	}
+	return true
+}
+
+// linkArrayClass returns the index of the size class (4, 8, 12, or 16 links) of a link array
+// allocated with the given capacity.
+func linkArrayClass(capacity uint8) uint8 {
+	switch {
+	case capacity <= 4:
+		return 0
+	case capacity <= 8:
+		return 1
+	case capacity <= 12:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// entry contains the traversal state for a key within a map, shared by map entry types.
+type entry struct {
+	r     *root
+	l     *link        // link containing the key-value or conflicting key-value for the key
+	path  [12]pathLink // links traversed from the root to l, if d < 12
+	h     uint64       // initial hash of the key
+	hd    uint64       // remaining hash bits for the key at depth d
+	d     uint8        // depth of the items of l
+	radix uint8        // radix of the key within l
+	stale bool         // the trie was modified through the entry
+}
+
+// item returns the link at the radix of the key within e.l, or nil if the radix is not present.
+// The traversed path is recorded when the link is present.
+func (e *entry) item() *link {
+	bit := uint32(1) << e.radix
+	if e.l.pmap&bit == 0 {
+		return nil
+	}
+	if e.d < uint8(len(e.path)) {
+		e.path[e.d] = pathLink{e.radix, e.l}
+	}
+	return (*link)(unsafe.Pointer(uintptr(e.l.ptr) + uintptr(bits.OnesCount32(e.l.pmap&(bit-1)))*linkSize))
+}
+
+// descend advances e to the branch at item, returning true if the hash of the key must be
+// recomputed for the new depth.
+func (e *entry) descend(item *link) (rehash bool) {
+	e.l = item
+	e.d++
+	if e.d%(64/4) != 0 { // hash bits available
+		e.hd >>= 4
+		return false
+	}
+	return true
+}
+
+// remove unlinks the key-value for the key of e, returning false if the traversed path
+// was too deep to be recorded, in which case the caller must remove the key by traversing
+// the trie again. In either case, e is marked stale.
+func (e *entry) remove() bool {
+	e.stale = true
+	if e.d >= uint8(len(e.path)) {
+		return false
+	}
+	e.r.unlink(e.path[:e.d+1], e.d, e.h)
+	return true
+}
+
+// batch contains the state of a batch operation, which walks a trie once for keys sorted by
+// hash path. Links traversed for each key are retained, and traversal for the next key starts
+// from the deepest link on the common prefix of both hash paths.
+type batch struct {
+	r     *root
+	keys  []batchKey
+	stack [64 / 4]pathLink // links and radixes traversed for the previous key
+	valid uint8            // number of valid links within stack
+	prev  uint64           // hash path of the previous key
+}
+
+// batchKey contains the initial hash of a key within a batch.
+type batchKey struct {
+	path uint64 // hash nibbles in traversal order, from the most significant
+	hash uint64
+	i    int // index of the key
+}
+
+// newBatch returns a batch for n keys within r, where the hash callback must return the initial
+// hash of the key at an index. Keys are sorted by hash path, then by index.
+func (r *root) newBatch(n int, hash func(int) uint64) batch {
+	b := batch{r: r, keys: make([]batchKey, n), valid: 1}
+	b.stack[0].link = &r.link
+	for i := range b.keys {
+		hd := hash(i)
+		b.keys[i] = batchKey{hashPath(hd), hd, i}
+	}
+	sort.Slice(b.keys, func(i, j int) bool {
+		x, y := &b.keys[i], &b.keys[j]
+		return x.path < y.path || (x.path == y.path && x.i < y.i)
+	})
+	return b
+}
+
+// checkMany panics if the values, or the found slice if it is not nil, passed to a batch
+// operation are shorter than its n keys. Reslicing alone would not panic for short slices
+// with a sufficient capacity.
+func checkMany(op string, n, values int, found []bool) {
+	if values < n {
+		panic("amt: " + op + ": values shorter than keys")
+	}
+	if found != nil && len(found) < n {
+		panic("amt: " + op + ": found shorter than keys")
+	}
+}
+
+// hashPath reverses the order of the 4-bit radixes within the hash h, so the radix of the root
+// level is the most significant. The reversal is its own inverse.
+func hashPath(h uint64) uint64 {
+	path := bits.ReverseBytes64(h)
+	return (path&0x0F0F0F0F0F0F0F0F)<<4 | (path&0xF0F0F0F0F0F0F0F0)>>4
+}
+
+// next traverses the hash path, returning the depth d of the link containing the key-value or
+// empty slot for the path, and the key-value link or nil. The link at depth d and its radix
+// are retained within the stack. If the path is exhausted before reaching a key-value or empty
+// slot, next returns false, and the key must be handled without the batch.
+func (b *batch) next(path uint64) (item *link, d uint8, ok bool) {
+	d = uint8(bits.LeadingZeros64(b.prev^path) / 4)
+	if d >= b.valid {
+		d = b.valid - 1
+	}
+	b.prev = path
+	l := b.stack[d].link
+	for {
+		radix := uint8(path>>(60-4*d)) & 0xF
+		b.stack[d].radix = radix
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 { // item missing
+			b.valid = d + 1
+			return nil, d, true
+		}
+		item = (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 { // key-value
+			b.valid = d + 1
+			return item, d, true
+		}
+		l = item
+		d++
+		if d == 64/4 { // rehash required
+			b.valid = d
+			return nil, d, false
+		}
+		b.stack[d].link = l
+	}
+}
+
+// insert inserts the key-value link kv at the empty slot returned by next at depth d.
+func (b *batch) insert(d uint8, kv link) {
+	b.r.insertItem(b.stack[d].link, d, b.stack[d].radix, b.hash(), kv)
+}
+
+// branch replaces the conflicting key-value item returned by next at depth d, as in branchItems.
+func (b *batch) branch(item *link, d uint8, hd, chd uint64, rehash func() (uint64, uint64), kv link) {
+	b.r.branchItems(b.stack[d].link, item, d, b.stack[d].radix, b.hash(), hd, chd, rehash, kv)
+}
+
+// remove unlinks the key-value returned by next at depth d.
+func (b *batch) remove(d uint8) {
+	path := append(b.r.path[:0], b.stack[:d+1]...)
+	b.valid = b.r.unlink(path, d, b.hash()) + 1
+}
+
+// hash returns the initial hash of the key passed to next, recovered from its hash path.
+func (b *batch) hash() uint64 {
+	return hashPath(b.prev)
+}
+
+// reset discards the retained links after the trie is modified without the batch.
+func (b *batch) reset() {
+	b.valid = 1
+}
+
 // pathLink references a branch traversed during deletion.
 type pathLink struct {
 	radix uint8
@@ -23,8 +23,16 @@
 package amt
 
 import (
+	"hash/fnv"
+	"hash/maphash"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestGeneric(t *testing.T) {
@@ -435,3 +443,1844 @@ func TestIntSet(t *testing.T) {
 		}
 	}
 }
+
+func TestRootSize(t *testing.T) {
+	if size := unsafe.Sizeof(root{}); size != 512 {
+		t.Fatalf("invalid root size %d", size)
+	}
+	if offset := unsafe.Offsetof(root{}.items); offset%64 != 0 {
+		t.Fatalf("unaligned root items (offset=%d)", offset)
+	}
+}
+
+func TestRandomOrder(t *testing.T) {
+	const N = 1000
+	order := func(m IntMap[int]) []IntKey {
+		keys := make([]IntKey, 0, N)
+		m.All(func(k IntKey, v *int) bool {
+			keys = append(keys, k)
+			return true
+		})
+		return keys
+	}
+	equal := func(a, b []IntKey) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return len(a) == len(b)
+	}
+
+	m, r := NewIntMap[int](), NewIntMap[int](RandomOrder)
+	for i := 0; i < N; i++ {
+		m.Set(IntKey(i), i)
+		r.Set(IntKey(i), i)
+	}
+	if !equal(order(m), order(m)) {
+		t.Fatal("order randomized without option")
+	}
+	first, randomized := order(r), false
+	for test := 0; test < 10 && !randomized; test++ {
+		next := order(r)
+		if len(next) != N {
+			t.Fatalf("invalid count %d", len(next))
+		}
+		seen := make(map[IntKey]bool, N)
+		for _, k := range next {
+			if seen[k] {
+				t.Fatalf("key visited twice (k=%d)", k)
+			}
+			seen[k] = true
+		}
+		randomized = !equal(first, next)
+	}
+	if !randomized {
+		t.Fatal("order not randomized")
+	}
+}
+
+func TestSorted(t *testing.T) {
+	const N = 10000
+	sm, im, bm := NewStringMap[int](), NewIntMap[int](), NewBytesMap[int]()
+	gm := NewMap[String, int]()
+	for i := 0; i < N; i++ {
+		sm.Set(strconv.Itoa(i), i)
+		im.Set(IntKey(i-N/2), i)
+		bm.Set([]byte(strconv.Itoa(i)), i)
+		gm.Set(String(strconv.Itoa(i)), i)
+	}
+
+	var prevs string
+	var visited int
+	sm.SortedAll(func(k string, v *int) bool {
+		if visited != 0 && k <= prevs {
+			t.Fatalf("invalid order (prev=%s, k=%s)", prevs, k)
+		}
+		if *v != sm.Val(k) {
+			t.Fatalf("invalid value (k=%s)", k)
+		}
+		prevs = k
+		visited++
+		return true
+	})
+	if visited != N {
+		t.Fatalf("invalid count %d", visited)
+	}
+	if keys := sm.SortedKeys(); len(keys) != N || keys[0] != "0" || keys[N-1] != "9999" {
+		t.Fatalf("invalid keys")
+	}
+
+	keys := im.SortedKeys()
+	for i, k := range keys {
+		if k != IntKey(i-N/2) {
+			t.Fatalf("invalid key (i=%d, k=%d)", i, k)
+		}
+	}
+	visited = 0
+	im.SortedAll(func(k IntKey, v *int) bool {
+		if k != IntKey(visited-N/2) || *v != visited {
+			t.Fatalf("invalid order (i=%d, k=%d)", visited, k)
+		}
+		visited++
+		return visited < N/2
+	})
+	if visited != N/2 {
+		t.Fatalf("iteration not stopped (count=%d)", visited)
+	}
+
+	bkeys := bm.SortedKeys()
+	if len(bkeys) != N || string(bkeys[0]) != "0" || string(bkeys[N-1]) != "9999" {
+		t.Fatalf("invalid keys")
+	}
+	visited = 0
+	bm.SortedAll(func(k []byte, v *int) bool {
+		if string(k) != string(bkeys[visited]) {
+			t.Fatalf("invalid order (i=%d)", visited)
+		}
+		visited++
+		return true
+	})
+
+	cmp := func(a, b String) int {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	gkeys, skeys := gm.SortedKeysFunc(cmp), sm.SortedKeys()
+	visited = 0
+	gm.SortedAllFunc(cmp, func(k String, v *int) bool {
+		if k != gkeys[visited] || string(k) != skeys[visited] {
+			t.Fatalf("invalid order (i=%d)", visited)
+		}
+		visited++
+		return visited < 100
+	})
+
+	// Keys which compare as equal are each visited once:
+	seen := make(map[String]bool, N)
+	var prevLen int
+	gm.SortedAllFunc(func(a, b String) int { return len(a) - len(b) }, func(k String, v *int) bool {
+		if len(k) < prevLen || seen[k] {
+			t.Fatalf("invalid order (k=%s)", k)
+		}
+		prevLen, seen[k] = len(k), true
+		return true
+	})
+	if len(seen) != N {
+		t.Fatalf("invalid count %d", len(seen))
+	}
+}
+
+func TestIntHighKeys(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewIntMap[int](), NewIntSet()
+	for i := 0; i < N; i++ {
+		m.Set(IntKey(i)<<32|IntKey(i), i)
+		s.Add(-IntKey(i))
+	}
+	for i := 0; i < N; i++ {
+		if v := m.Ptr(IntKey(i)<<32 | IntKey(i)); v == nil || *v != i {
+			t.Fatalf("value not set (i=%d)", i)
+		}
+		if !s.Has(-IntKey(i)) {
+			t.Fatalf("key not set (i=%d)", i)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewStringMap[int](), NewIntSet()
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		s.Add(IntKey(i))
+	}
+	if parts := m.Partition(0); len(parts) != 0 {
+		t.Fatal("invalid parts")
+	}
+	for _, n := range []uint{1, 2, 7, 16, 100} {
+		seen := make(map[string]bool, N)
+		var total uint
+		for _, p := range m.Partition(n) {
+			var visited uint
+			p.All(func(k string, v *int) bool {
+				if seen[k] {
+					t.Fatalf("key in multiple parts (n=%d, k=%s)", n, k)
+				}
+				if strconv.Itoa(*v) != k {
+					t.Fatalf("invalid value (k=%s)", k)
+				}
+				seen[k] = true
+				visited++
+				return true
+			})
+			if visited != p.Len() {
+				t.Fatalf("invalid part len %d (count=%d)", p.Len(), visited)
+			}
+			if want := N / n; p.Len() < want/2 || p.Len() > want*2 {
+				t.Fatalf("unbalanced part len %d (n=%d)", p.Len(), n)
+			}
+			total += p.Len()
+		}
+		if total != N || len(seen) != N {
+			t.Fatalf("invalid total %d (n=%d)", total, n)
+		}
+
+		var keys uint
+		for _, p := range s.Partition(n) {
+			p.All(func(k IntKey) bool {
+				keys++
+				return true
+			})
+		}
+		if keys != N {
+			t.Fatalf("invalid count %d (n=%d)", keys, n)
+		}
+	}
+}
+
+func TestPartitionFunc(t *testing.T) {
+	const N, P = 10 * 1000, 7
+	hash := func(k string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(k))
+		return h.Sum64()
+	}
+	// Maps built independently, with different seeds and insertion orders, have identical parts:
+	m1, m2 := NewStringMap[int](), NewStringMap[int]()
+	s1, s2 := NewIntSet(), NewIntSet()
+	for i := 0; i < N; i++ {
+		m1.Set(strconv.Itoa(i), i)
+		m2.Set(strconv.Itoa(N-1-i), N-1-i)
+		s1.Add(IntKey(i))
+		s2.Add(IntKey(N - 1 - i))
+	}
+	parts := func(p []StringMapPart[int]) []map[string]bool {
+		keys := make([]map[string]bool, len(p))
+		for i := range p {
+			keys[i] = make(map[string]bool)
+			p[i].All(func(k string, v *int) bool {
+				if strconv.Itoa(*v) != k {
+					t.Fatalf("invalid value (k=%s)", k)
+				}
+				keys[i][k] = true
+				return true
+			})
+			if uint(len(keys[i])) != p[i].Len() || p[i].Len() < N/P/2 {
+				t.Fatalf("invalid part len %d", p[i].Len())
+			}
+		}
+		return keys
+	}
+	p1, p2 := parts(m1.PartitionFunc(P, hash)), parts(m2.PartitionFunc(P, hash))
+	total := 0
+	for i := range p1 {
+		for k := range p1[i] {
+			if !p2[i][k] {
+				t.Fatalf("parts disagree (part=%d, k=%s)", i, k)
+			}
+		}
+		total += len(p2[i])
+	}
+	if total != N {
+		t.Fatalf("invalid total %d", total)
+	}
+	ihash := func(k IntKey) uint64 { return hash(strconv.Itoa(int(k))) }
+	ip1, ip2 := s1.PartitionFunc(P, ihash), s2.PartitionFunc(P, ihash)
+	for i := range ip1 {
+		ip1[i].All(func(k IntKey) bool {
+			if !p1[i][strconv.Itoa(int(k))] {
+				t.Fatalf("parts disagree (part=%d, k=%d)", i, k)
+			}
+			return true
+		})
+		if ip1[i].Len() != ip2[i].Len() || ip1[i].Len() != uint(len(p1[i])) {
+			t.Fatalf("invalid part len %d", ip1[i].Len())
+		}
+	}
+}
+
+func TestPartitionStable(t *testing.T) {
+	m := NewStringMap[int]()
+	// Keys within the root slot containing the first bound of 3 parts:
+	var keys []string
+	for i := 0; len(keys) < 256; i++ {
+		if k := strconv.Itoa(i); hashPath(m.itemHash(&link{ptr: unsafe.Pointer(&strkv[int]{k: k})}))>>60 == 5 {
+			keys = append(keys, k)
+		}
+	}
+	partOf := func(key string) (found int) {
+		found = -1
+		for i, p := range m.Partition(3) {
+			p.All(func(k string, _ *int) bool {
+				if k == key {
+					found = i
+				}
+				return true
+			})
+		}
+		return found
+	}
+	want := func(key string) int {
+		h := hashPath(m.itemHash(&link{ptr: unsafe.Pointer(&strkv[int]{k: key})}))
+		for i, p := range m.Partition(3) {
+			if h >= p.lo && h <= p.hi {
+				return i
+			}
+		}
+		return -1
+	}
+	for i, k := range keys {
+		m.Set(k, i)
+		// Colliding keys push earlier keys deeper, which must not move them between parts:
+		for _, k2 := range keys[:i+1] {
+			if part := partOf(k2); part != want(k2) {
+				t.Fatalf("key in part %d, want %d (k=%s, i=%d)", part, want(k2), k2, i)
+			}
+		}
+	}
+	parts := make(map[int]bool)
+	for _, k := range keys {
+		parts[want(k)] = true
+	}
+	if !parts[0] || !parts[1] {
+		t.Fatal("keys do not straddle the bound")
+	}
+}
+
+func TestClear(t *testing.T) {
+	const N = 100 * 1000
+	for _, opts := range [][]Option{nil, {Recycle}} {
+		m, s := NewStringMap[int](opts...), NewIntSet(opts...)
+		seed := m.seed
+		for test := 0; test < 3; test++ {
+			for i := 0; i < N; i++ {
+				m.Set(strconv.Itoa(i), i)
+				s.Add(IntKey(i))
+			}
+			if m.Len() != N || s.Len() != N {
+				t.Fatalf("invalid len %d", m.Len())
+			}
+			for i := 0; i < N; i++ {
+				if v := m.Ptr(strconv.Itoa(i)); v == nil || *v != i {
+					t.Fatalf("value not set (i=%d)", i)
+				}
+				if !s.Has(IntKey(i)) {
+					t.Fatalf("key not set (i=%d)", i)
+				}
+			}
+			m.Clear()
+			s.Clear()
+			if m.pool != nil && (len(m.pool.items) != N || len(s.pool.arrays[0]) == 0) {
+				t.Fatalf("items not recycled (count=%d)", len(m.pool.items))
+			}
+			if m.Len() != 0 || m.Dep() != 0 || s.Len() != 0 {
+				t.Fatalf("invalid len %d", m.Len())
+			}
+			if m.seed != seed {
+				t.Fatal("seed changed")
+			}
+			if m.Ptr("0") != nil || s.Has(0) {
+				t.Fatal("value not cleared")
+			}
+			m.All(func(string, *int) bool {
+				t.Fatal("value visited after clear")
+				return false
+			})
+		}
+	}
+}
+
+func TestRetain(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewStringMap[int](), NewIntSet()
+	m2, s2 := NewStringMap[int](), NewIntSet()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed, s2.seed = m.seed, s.seed
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		s.Add(IntKey(i))
+		if i%3 == 0 {
+			m2.Set(strconv.Itoa(i), i)
+			s2.Add(IntKey(i))
+		}
+	}
+	m.Retain(func(k string, v *int) bool { return *v%3 == 0 })
+	s.Retain(func(k IntKey) bool { return k%3 == 0 })
+	if m.Len() != m2.Len() || s.Len() != s2.Len() {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	// If depths are identical, the structures are almost certainly identical:
+	if m.Dep() != m2.Dep() || s.Dep() != s2.Dep() {
+		t.Fatalf("unequal depths (%v, %v)", m.Dep(), m2.Dep())
+	}
+	for i := 0; i < N; i++ {
+		if v := m.Ptr(strconv.Itoa(i)); (v != nil) != (i%3 == 0) {
+			t.Fatalf("value not retained (i=%d)", i)
+		}
+		if s.Has(IntKey(i)) != (i%3 == 0) {
+			t.Fatalf("key not retained (i=%d)", i)
+		}
+	}
+	for i := 0; i < N; i++ {
+		m2.Del(strconv.Itoa(i))
+		m.Del(strconv.Itoa(i))
+	}
+	if m.Len() != 0 || m.Dep() != 0 || m2.Len() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+
+	s.Retain(func(k IntKey) bool { return false })
+	if s.Len() != 0 || s.Dep() != 0 {
+		t.Fatalf("invalid len %d", s.Len())
+	}
+	s.Add(1)
+	if !s.Has(1) || s.Len() != 1 {
+		t.Fatal("key not set")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewStringMap[int](), NewIntSet()
+	m2, s2 := NewStringMap[int](), NewIntSet()
+	m3, s3 := NewStringMap[int](), NewIntSet()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed, s2.seed, m3.seed, s3.seed = m.seed, s.seed, m.seed, s.seed
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		s.Add(IntKey(i))
+		if i%3 == 0 {
+			m2.Set(strconv.Itoa(i), i)
+			s2.Add(IntKey(i))
+		} else {
+			m3.Set(strconv.Itoa(i), i)
+			s3.Add(IntKey(i))
+		}
+	}
+	alias := m
+	mm, mr := m.Drain(func(k string, v *int) bool { return *v%3 == 0 })
+	sm, sr := s.Drain(func(k IntKey) bool { return k%3 == 0 })
+	// Drain consumes its receiver, so copies of the receiver do not become either result:
+	if alias.Len() != 0 || alias.Ptr("3") != nil || m.Len() != 0 || s.Len() != 0 {
+		t.Fatal("values retained by consumed map")
+	}
+	if mm.Len() != m2.Len() || mr.Len() != m3.Len() || sm.Len() != s2.Len() || sr.Len() != s3.Len() {
+		t.Fatalf("invalid len (%d, %d)", mm.Len(), mr.Len())
+	}
+	// If depths are identical, the structures are almost certainly identical:
+	if mm.Dep() != m2.Dep() || mr.Dep() != m3.Dep() || sm.Dep() != s2.Dep() || sr.Dep() != s3.Dep() {
+		t.Fatalf("unequal depths (%v, %v)", mr.Dep(), m3.Dep())
+	}
+	for i := 0; i < N; i++ {
+		if v := mm.Ptr(strconv.Itoa(i)); (v != nil) != (i%3 == 0) {
+			t.Fatalf("value not retained (i=%d)", i)
+		}
+		if v := mr.Ptr(strconv.Itoa(i)); (v != nil) == (i%3 == 0) || (v != nil && *v != i) {
+			t.Fatalf("value not moved (i=%d)", i)
+		}
+		if sm.Has(IntKey(i)) != (i%3 == 0) || sr.Has(IntKey(i)) == (i%3 == 0) {
+			t.Fatalf("key not split (i=%d)", i)
+		}
+	}
+	for i := 0; i < N; i++ {
+		mm.Del(strconv.Itoa(i))
+		mr.Del(strconv.Itoa(i))
+	}
+	if mm.Len() != 0 || mm.Dep() != 0 || mr.Len() != 0 || mr.Dep() != 0 {
+		t.Fatalf("invalid len %d", mr.Len())
+	}
+
+	sm, sr = sm.Drain(func(k IntKey) bool { return false })
+	if sm.Len() != 0 || sm.Dep() != 0 || sr.Len() != s2.Len() || sr.Dep() != s2.Dep() {
+		t.Fatalf("invalid len %d", sr.Len())
+	}
+	for i := 0; i < N; i += 3 {
+		if !sr.Has(IntKey(i)) {
+			t.Fatalf("key not moved (i=%d)", i)
+		}
+	}
+	sr, sm = sr.Drain(func(k IntKey) bool { return true })
+	if sm.Len() != 0 || sm.Dep() != 0 || sr.Len() != s2.Len() || sr.Dep() != s2.Dep() {
+		t.Fatalf("invalid len %d", sr.Len())
+	}
+	sm.Add(1)
+	if !sm.Has(1) || sm.Len() != 1 {
+		t.Fatal("key not set")
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	const N = 100 * 1000
+	m, im := NewStringMap[int](), NewIntMap[int]()
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		im.Set(-IntKey(i), i)
+	}
+	sm := MapStringValues(m, func(k string, v *int) string { return k + "=" + strconv.Itoa(*v) })
+	if sm.seed != m.seed || sm.Len() != m.Len() || sm.Dep() != m.Dep() {
+		t.Fatal("layout not preserved")
+	}
+	fm := MapIntValues(im, func(k IntKey, v *int) float64 { return float64(*v) / 2 })
+	if fm.seed != im.seed || fm.Len() != im.Len() || fm.Dep() != im.Dep() {
+		t.Fatal("layout not preserved")
+	}
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if v, ok := sm.Get(k); !ok || v != k+"="+k {
+			t.Fatalf("value not mapped (i=%d)", i)
+		}
+		if v, ok := fm.Get(-IntKey(i)); !ok || v != float64(i)/2 {
+			t.Fatalf("value not mapped (i=%d)", i)
+		}
+	}
+	// The new map is independent of m:
+	m.Del("0")
+	sm.Set("x", "y")
+	if sm.Val("0") != "0=0" || m.Ptr("x") != nil {
+		t.Fatal("maps not independent")
+	}
+	for i := 0; i < N; i++ {
+		sm.Del(strconv.Itoa(i))
+	}
+	if sm.Len() != 1 || sm.Val("x") != "y" {
+		t.Fatalf("invalid len %d", sm.Len())
+	}
+}
+
+func TestFold(t *testing.T) {
+	const N = 1000
+	m, s := NewStringMap[int](), NewIntSet()
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		s.Add(IntKey(i))
+	}
+	sum := Fold(m.All, 0, func(acc int, k string, v *int) int { return acc + *v })
+	if sum != N*(N-1)/2 {
+		t.Fatalf("invalid sum %d", sum)
+	}
+	if n := CountIf(m.All, func(k string, v *int) bool { return *v%2 == 0 }); n != N/2 {
+		t.Fatalf("invalid count %d", n)
+	}
+	var visited int
+	if !AnyMatch(m.All, func(k string, v *int) bool { visited++; return *v >= 0 }) || visited != 1 {
+		t.Fatalf("invalid match (visited=%d)", visited)
+	}
+	if AnyMatch(m.All, func(k string, v *int) bool { return *v < 0 }) {
+		t.Fatal("invalid match")
+	}
+	if !AllMatch(m.All, func(k string, v *int) bool { return *v < N }) {
+		t.Fatal("invalid match")
+	}
+	visited = 0
+	if AllMatch(m.All, func(k string, v *int) bool { visited++; return false }) || visited != 1 {
+		t.Fatalf("invalid match (visited=%d)", visited)
+	}
+	if !AllMatch(NewStringMap[int]().All, func(k string, v *int) bool { return false }) {
+		t.Fatal("invalid match for empty map")
+	}
+
+	ksum := FoldSet(s.All, IntKey(0), func(acc, k IntKey) IntKey { return acc + k })
+	if ksum != N*(N-1)/2 {
+		t.Fatalf("invalid sum %d", ksum)
+	}
+	var psum IntKey
+	for _, p := range s.Partition(4) {
+		psum += FoldSet(p.All, IntKey(0), func(acc, k IntKey) IntKey { return acc + k })
+	}
+	if psum != ksum {
+		t.Fatalf("invalid sum %d", psum)
+	}
+	if n := CountSetIf(s.All, func(k IntKey) bool { return k < 10 }); n != 10 {
+		t.Fatalf("invalid count %d", n)
+	}
+	if !AnySetMatch(s.All, func(k IntKey) bool { return k == N-1 }) ||
+		AnySetMatch(s.All, func(k IntKey) bool { return k == N }) {
+		t.Fatal("invalid match")
+	}
+	if !AllSetMatch(s.All, func(k IntKey) bool { return k < N }) ||
+		AllSetMatch(s.All, func(k IntKey) bool { return k != 0 }) {
+		t.Fatal("invalid match")
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	const N = 1000
+	is, ss, gs := NewIntSet(), NewStringSet(), NewSet[String]()
+	for i := 0; i < N; i++ {
+		is.Add(IntKey(i))
+		ss.Add(strconv.Itoa(i))
+		gs.Add(String(strconv.Itoa(i)))
+	}
+
+	ig := GroupByInt(is.All, func(k IntKey) IntKey { return k % 10 })
+	if ig.Len() != 10 {
+		t.Fatalf("invalid len %d", ig.Len())
+	}
+	ig.All(func(g IntKey, group *IntSet) bool {
+		if group.Len() != N/10 {
+			t.Fatalf("invalid group len %d (g=%d)", group.Len(), g)
+		}
+		if !AllSetMatch(group.All, func(k IntKey) bool { return k%10 == g }) {
+			t.Fatalf("invalid group %d", g)
+		}
+		return true
+	})
+
+	sg := GroupByString(ss.All, func(k string) string { return k[:1] })
+	if sg.Len() != 10 || sg.Val("1").Len() != 111 || !sg.Val("9").Has("999") {
+		t.Fatalf("invalid groups (len=%d)", sg.Len())
+	}
+
+	gg := GroupBy(gs.All, func(k String) String { return String(strconv.Itoa(len(k))) })
+	if gg.Len() != 3 || gg.Val("1").Len() != 10 || gg.Val("2").Len() != 90 || gg.Val("3").Len() != 900 {
+		t.Fatalf("invalid groups (len=%d)", gg.Len())
+	}
+}
+
+func TestConvert(t *testing.T) {
+	const N = 10 * 1000
+	src, isrc := make(map[string]int, N), make(map[IntKey]int, N)
+	keys := make([]string, 0, N)
+	for i := 0; i < N; i++ {
+		src[strconv.Itoa(i)] = i
+		isrc[IntKey(i)<<40] = i
+		keys = append(keys, strconv.Itoa(i%(N/2)))
+	}
+	m, im, bm := NewStringMapFrom(src), NewIntMapFrom(isrc), NewBytesMapFrom(src)
+	if m.Len() != N || im.Len() != N || bm.Len() != N || m.pool != nil {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if m.Val(k) != i || im.Val(IntKey(i)<<40) != i || bm.Val([]byte(k)) != i {
+			t.Fatalf("value not set (i=%d)", i)
+		}
+	}
+	dst, idst, bdst := m.ToMap(), im.ToMap(), bm.ToMap()
+	if len(dst) != N || len(idst) != N || len(bdst) != N {
+		t.Fatalf("invalid len %d", len(dst))
+	}
+	for k, v := range src {
+		if dst[k] != v || bdst[k] != v {
+			t.Fatalf("value not converted (k=%s)", k)
+		}
+	}
+	gdst := ToMap(NewMapFrom(map[String]int{"a": 1, "b": 2}, Recycle))
+	if len(gdst) != 2 || gdst["a"] != 1 || gdst["b"] != 2 {
+		t.Fatalf("invalid map %v", gdst)
+	}
+
+	s := NewStringSetFrom(keys)
+	if s.Len() != N/2 {
+		t.Fatalf("invalid len %d", s.Len())
+	}
+	ks := s.ToSlice()
+	sort.Strings(ks)
+	if len(ks) != N/2 || ks[0] != "0" || ks[len(ks)-1] != "999" {
+		t.Fatalf("invalid slice (len=%d)", len(ks))
+	}
+	if is := NewIntSetFrom([]IntKey{3, 1, 2, 1}).ToSlice(); len(is) != 3 {
+		t.Fatalf("invalid slice %v", is)
+	}
+	if us := NewUint64SetFrom([]uint64{3, 1, 1 << 63, 1}).ToSlice(); len(us) != 3 {
+		t.Fatalf("invalid slice %v", us)
+	}
+	if gs := NewIntegerSetFrom([]int8{3, -1, 2, -1}).ToSlice(); len(gs) != 3 {
+		t.Fatalf("invalid slice %v", gs)
+	}
+	if fs := NewFloat64SetFrom([]float64{0, math.Copysign(0, -1), 0.5}).ToSlice(); len(fs) != 2 {
+		t.Fatalf("invalid slice %v", fs)
+	}
+	x, y := 1, 2
+	if ps := NewPtrSetFrom([]*int{&x, &y, &x}).ToSlice(); len(ps) != 2 || (ps[0] != &x && ps[1] != &x) {
+		t.Fatalf("invalid slice %v", ps)
+	}
+	hash := func(seed maphash.Seed, k []int, iter uint) uint64 { return Int(k[0]).Hash(seed, iter) }
+	equal := func(a, b []int) bool { return a[0] == b[0] }
+	if ks := NewSetFuncFrom([][]int{{1}, {2}, {1}}, hash, equal).ToSlice(); len(ks) != 2 {
+		t.Fatalf("invalid slice %v", ks)
+	}
+	if bm := NewBytesMapFrom(map[string]int{"": 1}); bm.Len() != 1 || bm.Val(nil) != 1 || NewBytesMapFrom(map[string]int{}).Len() != 0 {
+		t.Fatal("invalid empty key")
+	}
+	// Key-values are reserved in bounded blocks, which are taken from the end of the pool:
+	r := newRoot()
+	reserveItems[intkv[int]](r, 2*reserveBlock+1)
+	items := r.pool.items
+	if len(items) != 2*reserveBlock+1 {
+		t.Fatalf("invalid reservation %d", len(items))
+	}
+	for i := 1; i < len(items); i++ {
+		if i%reserveBlock != 1 && uintptr(items[i-1])-uintptr(items[i]) != unsafe.Sizeof(intkv[int]{}) {
+			t.Fatalf("invalid block (i=%d)", i)
+		}
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	const N = 100 * 1000
+	m, im := NewStringMap[int](), NewIntMap[int]()
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		im.Set(IntKey(i)<<33|IntKey(i), i)
+	}
+	s, is := m.KeySet(), im.KeySet()
+	if s.seed != m.seed || s.Len() != m.Len() || s.Dep() != m.Dep() {
+		t.Fatal("layout not preserved")
+	}
+	if is.seed != im.seed || is.Len() != im.Len() || is.Dep() != im.Dep() {
+		t.Fatal("layout not preserved")
+	}
+	for i := 0; i < N; i++ {
+		if !s.Has(strconv.Itoa(i)) || !is.Has(IntKey(i)<<33|IntKey(i)) {
+			t.Fatalf("key not found (i=%d)", i)
+		}
+	}
+	for i := 0; i < N; i++ {
+		s.Del(strconv.Itoa(i))
+		is.Del(IntKey(i)<<33 | IntKey(i))
+	}
+	if s.Len() != 0 || s.Dep() != 0 || is.Len() != 0 || is.Dep() != 0 || m.Len() != N {
+		t.Fatalf("invalid len %d", s.Len())
+	}
+}
+
+func TestBytesSetDel(t *testing.T) {
+	const N = 100 * 1000
+	s := NewBytesSet()
+	for i := 0; i < N; i++ {
+		s.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < N; i += 2 {
+		s.Del([]byte(strconv.Itoa(i)))
+		// Missing keys must not remove other keys:
+		s.Del([]byte(strconv.Itoa(-i - 1)))
+	}
+	for i := 0; i < N; i++ {
+		if s.Has([]byte(strconv.Itoa(i))) != (i%2 != 0) {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+	}
+	if s.Len() != N/2 {
+		t.Fatalf("invalid len %d", s.Len())
+	}
+}
+
+func TestSwap(t *testing.T) {
+	const N = 100 * 1000
+	m, im := NewStringMap[int](), NewIntMap[int]()
+	s, bs := NewIntSet(), NewBytesSet()
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if old, ok := m.Swap(k, i); ok || old != 0 {
+			t.Fatalf("invalid swap (i=%d)", i)
+		}
+		if old, ok := m.Swap(k, i+1); !ok || old != i {
+			t.Fatalf("invalid swap (i=%d)", i)
+		}
+		if _, ok := im.Swap(IntKey(i)<<32|1, i); ok {
+			t.Fatalf("invalid swap (i=%d)", i)
+		}
+		if !s.Insert(IntKey(i)) || s.Insert(IntKey(i)) {
+			t.Fatalf("invalid insert (i=%d)", i)
+		}
+		if !bs.Insert([]byte(k)) || bs.Insert([]byte(k)) {
+			t.Fatalf("invalid insert (i=%d)", i)
+		}
+	}
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if old, ok := m.Delete(k); !ok || old != i+1 {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+		if _, ok := m.Delete(k); ok {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+		if old, ok := im.Delete(IntKey(i)<<32 | 1); !ok || old != i {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+		if !s.Remove(IntKey(i)) || s.Remove(IntKey(i)) {
+			t.Fatalf("invalid remove (i=%d)", i)
+		}
+		if !bs.Remove([]byte(k)) || bs.Remove([]byte(k)) {
+			t.Fatalf("invalid remove (i=%d)", i)
+		}
+	}
+	if m.Len() != 0 || m.Dep() != 0 || im.Len() != 0 || s.Len() != 0 || bs.Len() != 0 || bs.Dep() != 0 {
+		t.Fatalf("invalid len %d", bs.Len())
+	}
+}
+
+func TestCompound(t *testing.T) {
+	const N = 100 * 1000
+	m, im := NewStringMap[int](), NewIntMap[int]()
+	eq := func(a, b int) bool { return a == b }
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if v, loaded := m.GetOrSet(k, i); loaded || v != i {
+			t.Fatalf("invalid get-or-set (i=%d)", i)
+		}
+		if v, loaded := m.GetOrSet(k, -1); !loaded || v != i {
+			t.Fatalf("invalid get-or-set (i=%d)", i)
+		}
+		if m.CompareAndSwapFunc(k, -1, 0, eq) || !m.CompareAndSwapFunc(k, i, i+1, eq) || m.Val(k) != i+1 {
+			t.Fatalf("invalid compare-and-swap (i=%d)", i)
+		}
+		im.Set(IntKey(i)<<36|IntKey(i), i)
+	}
+	if m.CompareAndSwapFunc("x", 0, 1, eq) || m.Len() != N {
+		t.Fatal("missing key swapped")
+	}
+	if v, loaded := m.LoadAndDelete("0"); !loaded || v != 1 || m.Ptr("0") != nil {
+		t.Fatal("invalid load-and-delete")
+	}
+	seen := make(map[IntKey]bool, N)
+	for i := N; i > 0; i-- {
+		k, v, ok := im.PopAny()
+		if !ok || seen[k] || k != IntKey(v)<<36|IntKey(v) || im.Len() != uint(i-1) {
+			t.Fatalf("invalid pop (i=%d)", i)
+		}
+		seen[k] = true
+		if i == N/2 { // compare with the canonical structure of the remaining keys
+			im2 := NewIntMap[int]()
+			im2.seed = im.seed
+			im.All(func(k IntKey, v *int) bool {
+				im2.Set(k, *v)
+				return true
+			})
+			if im.Dep() != im2.Dep() {
+				t.Fatalf("unequal depths (%v, %v)", im.Dep(), im2.Dep())
+			}
+		}
+	}
+	if _, _, ok := im.PopAny(); ok || im.Len() != 0 || im.Dep() != 0 {
+		t.Fatalf("invalid len %d", im.Len())
+	}
+	for n := m.Len(); n != 0; n-- {
+		if k, v, ok := m.PopAny(); !ok || k != strconv.Itoa(v-1) {
+			t.Fatalf("invalid pop %q", k)
+		}
+	}
+	if m.Len() != 0 || m.Dep() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	m.Set("a", 1)
+	if k, v, ok := m.PopAny(); !ok || k != "a" || v != 1 || m.Len() != 0 {
+		t.Fatal("invalid pop")
+	}
+}
+
+func TestGenericConflicts(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewMap[String, int](), NewSet[String]()
+	for i := 0; i < N; i++ {
+		k := String(strconv.Itoa(i))
+		m.Set(k, i)
+		s.Add(k)
+	}
+	for i := 0; i < N; i++ {
+		k := String(strconv.Itoa(i))
+		if m.Val(k) != i || !s.Has(k) {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+}
+
+func TestGenericModConflicts(t *testing.T) {
+	const N = 100 * 1000
+	m := NewMap[String, int]()
+	for i := 0; i < N; i++ {
+		m.Mod(String(strconv.Itoa(i)), func(v *int, _ bool) { *v = i })
+	}
+	for i := 0; i < N; i++ {
+		if m.Val(String(strconv.Itoa(i))) != i {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+}
+
+type testArrKey [4]byte
+
+func (k testArrKey) KeyBytes() (b [64]byte) {
+	copy(b[:], k[:])
+	return b
+}
+
+func TestArrMapConflicts(t *testing.T) {
+	const N = 100 * 1000
+	m := NewArrMap[testArrKey, int]()
+	arr := func(i int) testArrKey { return testArrKey{byte(i), byte(i >> 8), byte(i >> 16)} }
+	for i := 0; i < N; i++ {
+		m.Set(arr(i), i)
+	}
+	for i := 0; i < N; i++ {
+		if m.Val(arr(i)) != i {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+}
+
+func TestEntry(t *testing.T) {
+	const N = 100 * 1000
+	m, im, gm := NewStringMap[int](), NewIntMap[int](), NewMap[String, int]()
+	m2, im2 := NewStringMap[int](), NewIntMap[int]()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed, im2.seed = m.seed, im.seed
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		e, ie, ge := m.Entry(k), im.Entry(IntKey(i)<<40|IntKey(i)), gm.Entry(String(k))
+		if e.Exists() || e.Value() != nil || ie.Exists() || ge.Exists() {
+			t.Fatalf("invalid entry (i=%d)", i)
+		}
+		e.Insert(i)
+		ie.Insert(i)
+		ge.Insert(i)
+		if !e.Exists() || *e.Value() != i || !ie.Exists() || *ie.Value() != i {
+			t.Fatalf("value not inserted (i=%d)", i)
+		}
+		if i%3 == 0 { // remove and reinsert through the entry
+			e.Remove()
+			ie.Remove()
+			if e.Exists() || m.Ptr(k) != nil || ie.Exists() {
+				t.Fatalf("value not removed (i=%d)", i)
+			}
+			e.Insert(i)
+			ie.Insert(i)
+		}
+		*e.Value()++
+		m2.Set(k, i+1)
+		im2.Set(IntKey(i)<<40|IntKey(i), i)
+	}
+	if m.Len() != N || im.Len() != N || gm.Len() != N {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	// If depths are identical, the structures are almost certainly identical:
+	if m.Dep() != m2.Dep() || im.Dep() != im2.Dep() {
+		t.Fatalf("unequal depths (%v, %v)", m.Dep(), m2.Dep())
+	}
+	for i := 0; i < N; i++ {
+		k := strconv.Itoa(i)
+		if m.Val(k) != i+1 || im.Val(IntKey(i)<<40|IntKey(i)) != i || gm.Val(String(k)) != i {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+		e, ie, ge := m.Entry(k), im.Entry(IntKey(i)<<40|IntKey(i)), gm.Entry(String(k))
+		if !e.Exists() || !ie.Exists() || !ge.Exists() {
+			t.Fatalf("invalid entry (i=%d)", i)
+		}
+		e.Remove()
+		ie.Remove()
+		ge.Remove()
+		if m.Ptr(k) != nil || gm.Ptr(String(k)) != nil {
+			t.Fatalf("value not removed (i=%d)", i)
+		}
+	}
+	if m.Len() != 0 || m.Dep() != 0 || im.Len() != 0 || im.Dep() != 0 || gm.Len() != 0 || gm.Dep() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+}
+
+func TestBatch(t *testing.T) {
+	const N = 100 * 1000
+	m, im, gm := NewStringMap[int](), NewIntMap[int](), NewMap[String, int]()
+	m2, im2 := NewStringMap[int](), NewIntMap[int]()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed, im2.seed = m.seed, im.seed
+	keys, ikeys, gkeys, values := make([]string, N), make([]IntKey, N), make([]String, N), make([]int, N)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		ikeys[i] = IntKey(i)<<40 | IntKey(i)
+		gkeys[i] = String(keys[i])
+		values[i] = i
+	}
+	for i := 0; i < N; i += 1000 {
+		m.SetMany(keys[i:i+1000], values[i:i+1000])
+		im.SetMany(ikeys[i:i+1000], values[i:i+1000])
+		gm.SetMany(gkeys[i:i+1000], values[i:i+1000])
+	}
+	m.SetMany([]string{"x", "x"}, []int{1, 2})
+	for i := 0; i < N; i++ {
+		m2.Set(keys[i], i)
+		im2.Set(ikeys[i], i)
+	}
+	m2.Set("x", 2)
+	if m.Len() != m2.Len() || im.Len() != N || gm.Len() != N || m.Val("x") != 2 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	// If depths are identical, the structures are almost certainly identical:
+	if m.Dep() != m2.Dep() || im.Dep() != im2.Dep() {
+		t.Fatalf("unequal depths (%v, %v)", m.Dep(), m2.Dep())
+	}
+
+	out, found := make([]int, N+1), make([]bool, N+1)
+	if n := m.GetMany(append(keys, "y"), out, found); n != N || found[N] {
+		t.Fatalf("invalid count %d", n)
+	}
+	for i := 0; i < N; i++ {
+		if out[i] != i || !found[i] {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+	if n := im.GetMany(ikeys, out, nil); n != N || out[N-1] != N-1 {
+		t.Fatalf("invalid count %d", n)
+	}
+	if n := gm.GetMany(gkeys, out, nil); n != N || out[N-1] != N-1 {
+		t.Fatalf("invalid count %d", n)
+	}
+
+	// Delete every third key, then compare with the canonical structure:
+	var dkeys []string
+	var dikeys []IntKey
+	for i := 0; i < N; i += 3 {
+		dkeys = append(dkeys, keys[i], keys[i])
+		dikeys = append(dikeys, ikeys[i])
+		m2.Del(keys[i])
+		im2.Del(ikeys[i])
+	}
+	if n := m.DelMany(dkeys); n != len(dikeys) {
+		t.Fatalf("invalid count %d", n)
+	}
+	if n := im.DelMany(dikeys); n != len(dikeys) {
+		t.Fatalf("invalid count %d", n)
+	}
+	if m.Len() != m2.Len() || m.Dep() != m2.Dep() || im.Len() != im2.Len() || im.Dep() != im2.Dep() {
+		t.Fatalf("unequal depths (%v, %v)", m.Dep(), m2.Dep())
+	}
+	if n := m.DelMany(append(keys, "x")); n != int(m2.Len()) || m.Len() != 0 || m.Dep() != 0 {
+		t.Fatalf("invalid count %d", n)
+	}
+	if n := gm.DelMany(gkeys); n != N || gm.Len() != 0 || gm.Dep() != 0 {
+		t.Fatalf("invalid count %d", n)
+	}
+	// Short slices must panic, even with a sufficient capacity:
+	bm, short, found := NewBytesMap[int](), make([]int, 1, 4), make([]bool, 1, 4)
+	for name, f := range map[string]func(){
+		"StringMap.GetMany": func() { m.GetMany([]string{"a", "b"}, short, nil) },
+		"StringMap.SetMany": func() { m.SetMany([]string{"a", "b"}, short) },
+		"BytesMap.GetMany":  func() { bm.GetMany([][]byte{{'a'}, {'b'}}, short, nil) },
+		"BytesMap.SetMany":  func() { bm.SetMany([][]byte{{'a'}, {'b'}}, short) },
+		"IntMap.GetMany":    func() { im.GetMany([]IntKey{1, 2}, short, nil) },
+		"IntMap.SetMany":    func() { im.SetMany([]IntKey{1, 2}, short) },
+		"Map.GetMany":       func() { gm.GetMany([]String{"a", "b"}, short, nil) },
+		"Map.SetMany":       func() { gm.SetMany([]String{"a", "b"}, short) },
+		"found":             func() { m.GetMany([]string{"a", "b"}, values[:2], found) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+	if m.Len() != 0 || bm.Len() != 0 || gm.Len() != 0 {
+		t.Fatal("keys added by a short batch")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	const N, draws = 20, 200 * 1000
+	rng := rand.New(rand.NewSource(1))
+	m, s := NewStringMap[int](), NewIntSet()
+	if _, ok := m.RandomKey(rng); ok {
+		t.Fatal("key found in empty map")
+	}
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+		s.Add(IntKey(i) << 40)
+	}
+	counts, scounts := make(map[string]int), make(map[IntKey]int)
+	for i := 0; i < draws; i++ {
+		k, _ := m.RandomKey(rng)
+		counts[k]++
+		for _, k := range s.Sample(2, rng) {
+			scounts[k]++
+		}
+	}
+	// Each key should be selected with probability 1/N (2/N for samples of 2 keys):
+	for i := 0; i < N; i++ {
+		if c := counts[strconv.Itoa(i)]; c < draws/N*95/100 || c > draws/N*105/100 {
+			t.Fatalf("non-uniform selection (i=%d, count=%d)", i, c)
+		}
+		if c := scounts[IntKey(i)<<40]; c < 2*draws/N*95/100 || c > 2*draws/N*105/100 {
+			t.Fatalf("non-uniform sample (i=%d, count=%d)", i, c)
+		}
+	}
+	if keys := s.Sample(N+1, nil); len(keys) != N {
+		t.Fatalf("invalid sample len %d", len(keys))
+	}
+	for i := N; i > 0; i-- {
+		k, v, ok := m.PopRandom(rng)
+		if !ok || k != strconv.Itoa(v) || m.Len() != uint(i-1) {
+			t.Fatalf("invalid pop %q", k)
+		}
+	}
+	if _, _, ok := m.PopRandom(rng); ok || m.Dep() != 0 {
+		t.Fatal("key found in empty map")
+	}
+}
+
+func TestRandomCounts(t *testing.T) {
+	const N = 1 << 14
+	rng := rand.New(rand.NewSource(1))
+	m := NewStringMap[int]()
+	for i := 0; i < N; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	m.RandomKey(rng) // count keys
+	check := func(op string) {
+		t.Helper()
+		c := m.counts
+		if c == nil {
+			t.Fatalf("counts dropped by %s", op)
+		}
+		want := &counts{levels: make([][]uint64, len(c.levels))}
+		for i := range want.levels {
+			want.levels[i] = make([]uint64, len(c.levels[i]))
+		}
+		scanItems(&m.link, func(item *link) bool {
+			want.add(m.itemHash(item), 1)
+			return true
+		})
+		for i := range c.levels {
+			for p := range c.levels[i] {
+				if c.levels[i][p] != want.levels[i][p] {
+					t.Fatalf("invalid count after %s (prefix=%x, count=%d, want=%d)", op, p, c.levels[i][p], want.levels[i][p])
+				}
+			}
+		}
+	}
+	check("RandomKey")
+	m.Set("a", 1)
+	m.Delete("0")
+	check("Set/Delete")
+	m.Mod("b", func(v *int, _ bool) { *v = 2 })
+	check("Mod")
+	e := m.Entry("c")
+	e.Insert(3)
+	e = m.Entry("1")
+	e.Remove()
+	check("Entry")
+	m.SetMany([]string{"d", "e", "2"}, []int{4, 5, 2})
+	m.DelMany([]string{"3", "d", "missing"})
+	check("SetMany/DelMany")
+	m.PopAny()
+	check("PopAny")
+	for i := 0; i < N/2; i++ {
+		m.PopRandom(rng)
+	}
+	check("PopRandom")
+	drop, _ := m.RandomKey(rng)
+	m.Retain(func(k string, _ *int) bool { return k != drop })
+	if m.counts != nil {
+		t.Fatal("counts retained after Retain")
+	}
+	// Counts which do not match the keys panic instead of selecting past the counted radixes:
+	m.RandomKey(rng)
+	for _, level := range m.counts.levels {
+		for p := range level {
+			level[p] = 0
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("missing panic for invalid counts")
+			}
+		}()
+		m.RandomKey(rng)
+	}()
+	// Keys which collide for the first 16 levels are selected below the counted prefixes:
+	dm := NewMap[testDeepKey, int]()
+	for i := 0; i < 100; i++ {
+		dm.Set(testDeepKey(i), i)
+	}
+	seen := make(map[testDeepKey]bool)
+	for i := 100; i > 0; i-- {
+		k, v, ok := dm.PopRandom(rng)
+		if !ok || int(k) != v || seen[k] || dm.Len() != uint(i-1) {
+			t.Fatalf("invalid pop %d", k)
+		}
+		seen[k] = true
+	}
+	if dm.Dep() != 0 || dm.pmap != 0 {
+		t.Fatal("invalid layout after pops")
+	}
+}
+
+func BenchmarkRandomKey(b *testing.B) {
+	for _, n := range []int{1 << 10, 1 << 15, 1 << 20} {
+		m := NewIntMap[int]()
+		for i := 0; i < n; i++ {
+			m.Set(IntKey(i), i)
+		}
+		rng := rand.New(rand.NewSource(1))
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.RandomKey(rng)
+			}
+		})
+		b.Run(strconv.Itoa(n)+"/PopRandom", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k, v, _ := m.PopRandom(rng)
+				m.Set(k, v)
+			}
+		})
+	}
+}
+
+func TestUint64(t *testing.T) {
+	const N = 10 * 1000
+	m, s := NewUint64Map[int](), NewUint64Set()
+	for i := 0; i < N; i++ {
+		k := uint64(i) * 0x9E3779B97F4A7C15 // spread keys across the full unsigned range
+		m.Set(k, i)
+		if !s.Insert(k) {
+			t.Fatalf("key not inserted (i=%d)", i)
+		}
+	}
+	if m.Len() != N || s.Len() != N {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i := 0; i < N; i++ {
+		k := uint64(i) * 0x9E3779B97F4A7C15
+		if v, ok := m.Get(k); !ok || v != i || !s.Has(k) {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+	keys := m.SortedKeys()
+	if !sort.SliceIsSorted(keys, func(i, j int) bool { return keys[i] < keys[j] }) || keys[N-1] < 1<<63 {
+		t.Fatal("keys not sorted")
+	}
+	var prev uint64
+	m.SortedAll(func(k uint64, v *int) bool {
+		if k < prev || k != uint64(*v)*0x9E3779B97F4A7C15 {
+			t.Fatalf("invalid key %d", k)
+		}
+		prev = k
+		return true
+	})
+	ks := m.KeySet()
+	ks.Retain(func(k uint64) bool { return k >= 1<<63 })
+	s.All(func(k uint64) bool {
+		if ks.Has(k) != (k >= 1<<63) {
+			t.Fatalf("key not retained %d", k)
+		}
+		return true
+	})
+	for i := 0; i < N; i++ {
+		k := uint64(i) * 0x9E3779B97F4A7C15
+		m.Del(k)
+		s.Del(k)
+	}
+	if m.Len() != 0 || m.Dep() != 0 || s.Len() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+}
+
+func TestInteger(t *testing.T) {
+	type shard int8
+	m, s := NewIntegerMap[shard, int](), NewIntegerSet[uint16]()
+	m2, s2 := NewIntegerMap[shard, int](), NewIntegerSet[uint16]()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed, s2.seed = m.seed, s.seed
+	for i := -128; i < 128; i++ {
+		m.Set(shard(i), i)
+		if old, ok := m.Swap(shard(i), i*2); !ok || old != i {
+			t.Fatalf("invalid swap (i=%d)", i)
+		}
+	}
+	for i := 127; i >= -128; i-- {
+		m2.Mod(shard(i), func(v *int, ok bool) { *v = i * 2 })
+	}
+	for i := 0; i < 1<<16; i++ {
+		if !s.Insert(uint16(i)) {
+			t.Fatalf("key not inserted (i=%d)", i)
+		}
+		s2.Add(uint16(1<<16 - 1 - i))
+	}
+	if m.Len() != 256 || s.Len() != 1<<16 || m.Dep() != m2.Dep() || s.Dep() != s2.Dep() {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	keys := m.SortedKeys()
+	if len(keys) != 256 || keys[0] != -128 || keys[255] != 127 {
+		t.Fatalf("invalid keys %v", keys)
+	}
+	m.All(func(k shard, v *int) bool {
+		if *v != int(k)*2 || m.Val(k) != int(k)*2 {
+			t.Fatalf("invalid value for key %d", k)
+		}
+		return true
+	})
+	m.Retain(func(k shard, _ *int) bool { return k < 0 })
+	s.Retain(func(k uint16) bool { return k%2 == 0 })
+	for i := -128; i < 128; i++ {
+		if _, ok := m.Get(shard(i)); ok != (i < 0) {
+			t.Fatalf("value not retained (i=%d)", i)
+		}
+		if old, ok := m.Delete(shard(i)); ok != (i < 0) || (ok && old != i*2) {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+	}
+	for i := 0; i < 1<<16; i++ {
+		if s.Has(uint16(i)) != (i%2 == 0) || s.Remove(uint16(i)) != (i%2 == 0) {
+			t.Fatalf("key not retained (i=%d)", i)
+		}
+	}
+	if m.Len() != 0 || m.Dep() != 0 || s.Len() != 0 || s.Dep() != 0 {
+		t.Fatalf("invalid len %d", s.Len())
+	}
+}
+
+func TestInt32Map(t *testing.T) {
+	const N = 100 * 1000
+	m, fm := NewInt32Map[uint16](), NewInt32Map[float32]()
+	m2 := NewInt32Map[uint16]()
+	// Structures should be identical/canonical for a given hash seed:
+	m2.seed = m.seed
+	for i := 0; i < N; i++ {
+		k := int32(i) - N/2
+		m.Set(k, uint16(i))
+		if old, ok := m.Swap(k, uint16(i+1)); !ok || old != uint16(i) {
+			t.Fatalf("invalid swap (i=%d)", i)
+		}
+		fm.Mod(k, func(v *float32, ok bool) { *v = float32(k) / 2 })
+		m2.Set(N/2-1-int32(i), 0)
+	}
+	if m.Len() != N || fm.Len() != N || m.Dep() != m2.Dep() {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i := 0; i < N; i++ {
+		k := int32(i) - N/2
+		if v, ok := m.Get(k); !ok || v != uint16(i+1) || fm.Val(k) != float32(k)/2 {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+	n := 0
+	m.All(func(k int32, v uint16) bool {
+		if v != uint16(k+N/2+1) {
+			t.Fatalf("invalid value for key %d", k)
+		}
+		n++
+		return true
+	})
+	if keys := fm.SortedKeys(); n != N || len(keys) != N || keys[0] != -N/2 || keys[N-1] != N/2-1 {
+		t.Fatal("invalid keys")
+	}
+	m.Retain(func(k int32, _ uint16) bool { return k%2 == 0 })
+	for i := 0; i < N; i++ {
+		k := int32(i) - N/2
+		if old, ok := m.Delete(k); ok != (k%2 == 0) || (ok && old != uint16(i+1)) {
+			t.Fatalf("invalid delete (i=%d)", i)
+		}
+		fm.Del(k)
+	}
+	if m.Len() != 0 || m.Dep() != 0 || fm.Len() != 0 || fm.Dep() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+}
+
+func TestComparable(t *testing.T) {
+	const N = 100 * 1000
+	type point struct {
+		name string
+		x, y int32
+	}
+	m, s := NewComparableMap[point, int](), NewComparableSet[point]()
+	for i := 0; i < N; i++ {
+		p := point{strconv.Itoa(i % 100), int32(i), -int32(i)}
+		m.Set(p, i)
+		if !s.Insert(p) || s.Insert(p) {
+			t.Fatalf("invalid insert (i=%d)", i)
+		}
+	}
+	if m.Len() != N || s.Len() != N {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i := 0; i < N; i++ {
+		// Keys are compared with ==, so equal strings need not share memory:
+		p := point{string([]byte(strconv.Itoa(i % 100))), int32(i), -int32(i)}
+		if v, ok := m.Get(p); !ok || v != i || !s.Has(p) {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+	}
+	if v, ok := m.GetOrSet(point{"x", 1, 1}, -1); ok || v != -1 || len(m.ToMap()) != N+1 {
+		t.Fatal("value not set")
+	}
+	ks := m.KeySet()
+	ks.Retain(func(p point) bool { return p.x%2 == 0 })
+	for i := 0; i < N; i++ {
+		p := point{strconv.Itoa(i % 100), int32(i), -int32(i)}
+		if ks.Has(p) != (i%2 == 0) {
+			t.Fatalf("key not retained (i=%d)", i)
+		}
+		m.Del(p)
+		s.Del(p)
+	}
+	if m.Len() != 1 || s.Len() != 0 || s.Dep() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+}
+
+func TestHashComparable(t *testing.T) {
+	// Toolchains before Go 1.24 hash keys with writeComparable, which is covered by running
+	// this test with such a toolchain:
+	type blank struct {
+		a int
+		_ int
+		b string
+	}
+	seed := maphash.MakeSeed()
+	x, y := blank{a: 1, b: "b"}, blank{a: 1, b: "b"}
+	*(*int)(unsafe.Pointer(uintptr(unsafe.Pointer(&y)) + unsafe.Sizeof(y.a))) = 1 // set the blank field
+	if x != y || hashComparable(seed, x, 0) != hashComparable(seed, y, 0) {
+		t.Fatal("blank field hashed")
+	}
+	if hashComparable(seed, x, 0) == hashComparable(seed, blank{a: 2, b: "b"}, 0) ||
+		hashComparable(seed, x, 0) == hashComparable(seed, blank{a: 1, b: "c"}, 0) ||
+		hashComparable(seed, x, 0) == hashComparable(seed, x, 1) {
+		t.Fatal("field not hashed")
+	}
+	// Values which are equal under == are hashed identically:
+	type mixed struct {
+		f float64
+		p *int
+	}
+	v, w := 1, 1
+	sum := func(key mixed) uint64 { return hashComparable(seed, key, 0) }
+	if sum(mixed{0, &v}) != sum(mixed{math.Copysign(0, -1), &v}) {
+		t.Fatal("signed zeros hashed differently")
+	}
+	if sum(mixed{0, &v}) == sum(mixed{0, &w}) || sum(mixed{0, &v}) == sum(mixed{0, nil}) {
+		t.Fatal("distinct values hashed identically")
+	}
+	m := NewComparableMap[blank, int]()
+	m.Set(x, 1)
+	if v, ok := m.Get(y); !ok || v != 1 {
+		t.Fatal("value not found")
+	}
+}
+
+func TestFunc(t *testing.T) {
+	const N = 100 * 1000
+	hash := func(seed maphash.Seed, key []int, iter uint) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(seed)
+		for i := uint(0); i <= iter; i++ {
+			for _, k := range key {
+				b := intbytes(IntKey(k))
+				hw.Write(b[:])
+			}
+		}
+		return hw.Sum64()
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	// The first hash of every key collides, so all keys are rehashed below the 16th level:
+	colliding := func(seed maphash.Seed, key []int, iter uint) uint64 {
+		if iter == 0 {
+			return 0
+		}
+		return hash(seed, key, iter)
+	}
+	for _, hash := range []func(maphash.Seed, []int, uint) uint64{hash, colliding} {
+		m, s := NewMapFunc[[]int, int](hash, equal), NewSetFunc(hash, equal)
+		for i := 0; i < N; i++ {
+			m.Set([]int{i, -i}, i)
+			if !s.Insert([]int{i, -i}) || s.Insert([]int{i, -i}) {
+				t.Fatalf("invalid insert (i=%d)", i)
+			}
+		}
+		if m.Len() != N || s.Len() != N {
+			t.Fatalf("invalid len %d", m.Len())
+		}
+		for i := 0; i < N; i++ {
+			if v, ok := m.Get([]int{i, -i}); !ok || v != i || !s.Has([]int{i, -i}) {
+				t.Fatalf("value not found (i=%d)", i)
+			}
+		}
+		if _, ok := m.Get([]int{-1, 1}); ok || s.Has([]int{-1, 1}) {
+			t.Fatal("missing key found")
+		}
+		ks := m.KeySet()
+		match, rest := ks.Drain(func(k []int) bool { return k[0]%2 == 0 })
+		for i := 0; i < N; i++ {
+			if match.Has([]int{i, -i}) != (i%2 == 0) || rest.Has([]int{i, -i}) != (i%2 != 0) {
+				t.Fatalf("key not split (i=%d)", i)
+			}
+			if v, ok := m.Delete([]int{i, -i}); !ok || v != i || !s.Remove([]int{i, -i}) {
+				t.Fatalf("value not deleted (i=%d)", i)
+			}
+		}
+		if m.Len() != 0 || m.Dep() != 0 || s.Len() != 0 || s.Dep() != 0 {
+			t.Fatalf("invalid len %d", m.Len())
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	utc := time.Date(2022, 3, 4, 5, 6, 7, 8, time.UTC)
+	testKeys(t, []Int{0, 1, -1, 1 << 40}, []Int{0, 1, -1, 1 << 40})
+	testKeys(t, []Uint{0, 1, 1 << 63}, []Uint{0, 1, 1 << 63})
+	testKeys(t, []Int32{0, 1, -1}, []Int32{0, 1, -1})
+	testKeys(t, []Uint32{0, 1, 1 << 31}, []Uint32{0, 1, 1 << 31})
+	testKeys(t, []Int8{0, 1, -1, -128}, []Int8{0, 1, -1, -128})
+	testKeys(t, []Int16{0, 1, -1, -1 << 15}, []Int16{0, 1, -1, -1 << 15})
+	testKeys(t, []Int64{0, 1, -1, -1 << 63}, []Int64{0, 1, -1, -1 << 63})
+	testKeys(t, []Uint8{0, 1, 255}, []Uint8{0, 1, 255})
+	testKeys(t, []Byte{0, 'a', 255}, []Byte{0, 'a', 255})
+	testKeys(t, []Uint16{0, 1, 1 << 15}, []Uint16{0, 1, 1 << 15})
+	testKeys(t, []Uint64{0, 1, 1 << 63}, []Uint64{0, 1, 1 << 63})
+	testKeys(t, []Uintptr{0, 1, 1 << 31}, []Uintptr{0, 1, 1 << 31})
+	testKeys(t, []Rune{'a', 'ä', '世'}, []Rune{'a', 'ä', '世'})
+	testKeys(t, []Bool{false, true}, []Bool{false, true})
+	testKeys(t,
+		[]Float64{0, 1, Float64(math.Inf(-1)), Float64(math.NaN())},
+		[]Float64{Float64(math.Copysign(0, -1)), 1, Float64(math.Inf(-1)), Float64(-math.NaN())})
+	testKeys(t,
+		[]Float32{0, 1, Float32(math.Inf(-1)), Float32(math.NaN())},
+		[]Float32{Float32(math.Copysign(0, -1)), 1, Float32(math.Inf(-1)), Float32(-math.NaN())})
+	testKeys(t,
+		[]Time{Time(utc), Time(utc.Add(1)), Time(time.Time{})},
+		[]Time{Time(utc.In(time.FixedZone("x", 3600))), Time(utc.Add(1).Local()), Time(time.Unix(-62135596800, 0))})
+	now := time.Now() // with a monotonic clock reading
+	testKeys(t, []Time{Time(now)}, []Time{Time(now.Round(0).In(time.FixedZone("y", -7200)))})
+}
+
+// testKeys checks that each key in keys is equal to the key at the same index in equal,
+// and distinct from all other keys in both slices, within a generic map and set.
+func testKeys[K Key[K]](t *testing.T, keys, equal []K) {
+	t.Helper()
+	m, s := NewMap[K, int](), NewSet[K]()
+	for i, k := range keys {
+		if !k.Equal(equal[i]) || !equal[i].Equal(k) || k.Hash(m.seed, 0) != equal[i].Hash(m.seed, 0) ||
+			k.Hash(m.seed, 1) != equal[i].Hash(m.seed, 1) {
+			t.Fatalf("keys not equal (i=%d)", i)
+		}
+		m.Set(k, i)
+		if !s.Insert(k) || s.Insert(equal[i]) {
+			t.Fatalf("invalid insert (i=%d)", i)
+		}
+	}
+	if m.Len() != uint(len(keys)) || s.Len() != uint(len(keys)) {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i, k := range equal {
+		if v, ok := m.Get(k); !ok || v != i || !s.Has(k) {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+		if !s.Remove(k) || s.Has(keys[i]) {
+			t.Fatalf("key not removed (i=%d)", i)
+		}
+	}
+}
+
+func TestPtr(t *testing.T) {
+	const N = 100 * 1000
+	type node struct{ id int }
+	for _, opt := range []Option{0, Recycle} {
+		m, s := NewPtrMap[node, int](opt), NewPtrSet[node](opt)
+		keep := make([]*node, 0, N/2)
+		for i := 0; i < N; i++ {
+			n := &node{i}
+			m.Set(n, i)
+			if !s.Insert(n) || s.Insert(n) {
+				t.Fatalf("invalid insert (i=%d)", i)
+			}
+			if i%2 == 0 {
+				keep = append(keep, n)
+			}
+		}
+		// Odd nodes are only referenced by m and s:
+		runtime.GC()
+		garbage := make([][]int, 0, N)
+		for i := 0; i < N; i++ {
+			garbage = append(garbage, []int{-1, -1})
+		}
+		count := 0
+		m.All(func(n *node, v *int) bool {
+			if n.id != *v || !s.Has(n) {
+				t.Fatalf("invalid key %d for value %d", n.id, *v)
+			}
+			count++
+			return true
+		})
+		if count != N || len(s.ToSlice()) != N || len(garbage) != N {
+			t.Fatalf("invalid count %d", count)
+		}
+		if m.Ptr(&node{0}) != nil || s.Has(&node{0}) {
+			t.Fatal("keys compared by value")
+		}
+		s.Retain(func(n *node) bool { return n.id%2 == 0 })
+		for i, n := range keep {
+			if !s.Has(n) {
+				t.Fatalf("key not found (i=%d)", i)
+			}
+			if v, ok := m.Delete(n); !ok || v != n.id {
+				t.Fatalf("value not deleted (i=%d)", i)
+			}
+		}
+		if s.Len() != N/2 || m.Len() != N/2 {
+			t.Fatalf("invalid len %d", m.Len())
+		}
+		s.Clear()
+		m.Clear()
+		// Recycled key-values must not alias keys:
+		for i := 0; i < N; i++ {
+			m.Set(&node{-i}, -i)
+		}
+		for i, n := range keep {
+			if n.id != 2*i {
+				t.Fatalf("key released (i=%d)", i)
+			}
+		}
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	const N = 10 * 1000
+	nan, negz := math.NaN(), math.Copysign(0, -1)
+	for _, opt := range []Option{0, TotalOrder} {
+		m, s := NewFloat64Map[int](opt), NewFloat64Set(opt)
+		for i := 0; i < N; i++ {
+			f := float64(i) / 7
+			m.Set(f, i)
+			m.Set(-f, -i)
+			if !s.Insert(f) || s.Insert(f) {
+				t.Fatalf("invalid insert (i=%d)", i)
+			}
+		}
+		if m.Len() != 2*N-1 || s.Len() != N {
+			t.Fatalf("invalid len %d", m.Len())
+		}
+		if v, ok := m.Get(negz); !ok || v != 0 || !s.Has(negz) || math.Signbit(m.SortedKeys()[N-1]) {
+			t.Fatal("negative zero not equal to positive zero")
+		}
+		total := opt == TotalOrder
+		// Without TotalOrder, each NaN key is a new key, as in builtin maps:
+		bm, bs := make(map[float64]int), make(map[float64]struct{})
+		nanKey := func(f float64) float64 {
+			if total {
+				return 0 // a single key
+			}
+			return f
+		}
+		for i, f := range []float64{nan, -nan, nan, math.Float64frombits(math.Float64bits(nan) + 1)} {
+			_, existed := bm[nanKey(f)]
+			bm[nanKey(f)] = -i - 1
+			if _, ok := m.Swap(f, -i-1); ok != existed {
+				t.Fatalf("invalid NaN swap (i=%d)", i)
+			}
+			_, existed = bs[nanKey(f)]
+			bs[nanKey(f)] = struct{}{}
+			if s.Insert(f) == existed {
+				t.Fatalf("invalid NaN insert (i=%d)", i)
+			}
+		}
+		m.Mod(nan, func(v *int, existed bool) {
+			if _, ok := bm[nanKey(nan)]; existed != ok || (ok && *v != bm[nanKey(nan)]) || (!ok && *v != 0) {
+				t.Fatal("invalid NaN mod")
+			}
+			*v = -5
+		})
+		bm[nanKey(nan)] = -5
+		if v, loaded := m.GetOrSet(nan, -6); loaded != total || v != map[bool]int{false: -6, true: -5}[total] {
+			t.Fatal("invalid NaN value")
+		}
+		if !total {
+			bm[nan] = -6
+		}
+		if m.Len() != 2*N-1+uint(len(bm)) || s.Len() != N+uint(len(bs)) {
+			t.Fatalf("invalid len %d, %d", m.Len(), s.Len())
+		}
+		nans, sum := 0, 0
+		m.All(func(k float64, v *int) bool {
+			if math.IsNaN(k) {
+				nans, sum = nans+1, sum+*v
+			}
+			return true
+		})
+		bsum := 0
+		for _, v := range bm {
+			bsum += v
+		}
+		if nans != len(bm) || sum != bsum {
+			t.Fatalf("invalid NaN keys %d", nans)
+		}
+		if _, ok := bs[nanKey(nan)]; s.Has(nan) != ok || s.Has(nan) != total {
+			t.Fatal("invalid NaN lookup")
+		}
+		if v, ok := m.Get(math.Float64frombits(math.Float64bits(nan) + 1)); ok != total || (total && v != -5) {
+			t.Fatal("invalid NaN value")
+		}
+		if keys := m.SortedKeys(); !math.IsNaN(keys[len(bm)-1]) || math.IsNaN(keys[len(bm)]) {
+			t.Fatalf("invalid sorted keys %v", keys[:len(bm)+1])
+		}
+		if _, ok := m.Delete(nan); ok != total || s.Remove(nan) != total {
+			t.Fatal("invalid NaN delete")
+		}
+		m.Retain(func(k float64, _ *int) bool { return !math.IsNaN(k) })
+		s.Retain(func(k float64) bool { return !math.IsNaN(k) })
+		for i := 0; i < N; i++ {
+			f := float64(i) / 7
+			if v, ok := m.Get(-f); !ok || v != -i || !s.Remove(f) {
+				t.Fatalf("value not found (i=%d)", i)
+			}
+		}
+		if m.Len() != 2*N-1 || s.Len() != 0 {
+			t.Fatalf("invalid len %d", m.Len())
+		}
+	}
+}
+
+func TestTuples(t *testing.T) {
+	const N = 100 * 1000
+	m, s := NewMap[Pair[String, Int], int](), NewSet[Triple[Int, Bool, Pair[Int, Float64]]]()
+	for i := 0; i < N; i++ {
+		m.Set(MakePair(String(strconv.Itoa(i%1000)), Int(i/1000)), i)
+		if !s.Insert(MakeTriple(Int(i/2), Bool(i%2 == 0), MakePair(Int(-i), Float64(i)))) {
+			t.Fatalf("invalid insert (i=%d)", i)
+		}
+	}
+	if m.Len() != N || s.Len() != N {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	for i := 0; i < N; i++ {
+		if v, ok := m.Get(MakePair(String(strconv.Itoa(i%1000)), Int(i/1000))); !ok || v != i {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+		if !s.Has(MakeTriple(Int(i/2), Bool(i%2 == 0), MakePair(Int(-i), Float64(i)))) ||
+			s.Has(MakeTriple(Int(i/2), Bool(i%2 != 0), MakePair(Int(-i), Float64(i)))) {
+			t.Fatalf("key not found (i=%d)", i)
+		}
+	}
+	// Components are hashed in order:
+	p, q := MakePair(Int(1), Int(2)), MakePair(Int(2), Int(1))
+	for iter := uint(0); iter < 4; iter++ {
+		if p.Hash(m.seed, iter) == q.Hash(m.seed, iter) || p.Hash(m.seed, iter) == p.Hash(m.seed, iter+1) {
+			t.Fatalf("invalid hash (iter=%d)", iter)
+		}
+	}
+	if p.Equal(q) || !p.Equal(MakePair(Int(1), Int(2))) {
+		t.Fatal("invalid equality")
+	}
+	for i := 0; i < N; i++ {
+		if v, ok := m.Delete(MakePair(String(strconv.Itoa(i%1000)), Int(i/1000))); !ok || v != i {
+			t.Fatalf("value not deleted (i=%d)", i)
+		}
+	}
+	if m.Len() != 0 || m.Dep() != 0 {
+		t.Fatalf("invalid len %d", m.Len())
+	}
+	// Components implementing Key need not be comparable, and are compared with Equal:
+	bm := NewMap[Pair[Bytes, Float64], int]()
+	bm.Set(MakePair(Bytes("a"), Float64(math.NaN())), 1)
+	if v, ok := bm.Get(MakePair(Bytes([]byte("a")), Float64(math.NaN()))); !ok || v != 1 {
+		t.Fatal("value not found")
+	}
+	// Comparable components are compared with ==, where NaN values are not equal:
+	cm, cs := NewMap[ComparablePair[string, int], int](), NewSet[ComparableTriple[int, bool, ComparablePair[string, float64]]]()
+	for i := 0; i < N; i++ {
+		cm.Set(MakeComparablePair(strconv.Itoa(i%1000), i/1000), i)
+		cs.Add(MakeComparableTriple(i/2, i%2 == 0, MakeComparablePair(strconv.Itoa(-i), float64(i))))
+	}
+	if cm.Len() != N || cs.Len() != N {
+		t.Fatalf("invalid len %d", cm.Len())
+	}
+	for i := 0; i < N; i++ {
+		if v, ok := cm.Get(MakeComparablePair(strconv.Itoa(i%1000), i/1000)); !ok || v != i {
+			t.Fatalf("value not found (i=%d)", i)
+		}
+		if !cs.Has(MakeComparableTriple(i/2, i%2 == 0, MakeComparablePair(strconv.Itoa(-i), float64(i)))) ||
+			cs.Has(MakeComparableTriple(i/2, i%2 != 0, MakeComparablePair(strconv.Itoa(-i), float64(i)))) {
+			t.Fatalf("key not found (i=%d)", i)
+		}
+	}
+	nm := NewMap[ComparablePair[float64, int], int]()
+	nm.Set(MakeComparablePair(math.NaN(), 1), 1)
+	if _, ok := nm.Get(MakeComparablePair(math.NaN(), 1)); ok {
+		t.Fatal("NaN component equal with ==")
+	}
+}
+
+// testDeepKey collides with all other keys for the first 16 levels of a trie.
+type testDeepKey int
+
+func (k testDeepKey) Equal(c testDeepKey) bool { return k == c }
+
+func (k testDeepKey) Hash(seed maphash.Seed, iter uint) uint64 {
+	if iter == 0 {
+		return 0
+	}
+	return Int(k).Hash(seed, iter)
+}
+
+func TestEntryDeep(t *testing.T) {
+	// Keys collide for the first 16 levels, past the path recorded by each entry, so keys are
+	// removed through entries by a second traversal:
+	const N = 1000
+	m := NewMap[testDeepKey, int]()
+	for i := 0; i < N; i++ {
+		m.Set(testDeepKey(i), i)
+	}
+	if m.Dep() <= 16 {
+		t.Fatalf("invalid depth %v", m.Dep())
+	}
+	for i := 0; i < N; i += 2 {
+		e := m.Entry(testDeepKey(i))
+		e.Remove()
+		if _, ok := m.Get(testDeepKey(i)); ok || e.Exists() || m.Len() != N-1 {
+			t.Fatalf("invalid entry remove (i=%d)", i)
+		}
+		e.Insert(-i)
+	}
+	for i := 1; i < N; i += 2 {
+		e := m.Entry(testDeepKey(i))
+		e.Remove()
+	}
+	count := 0
+	m.All(func(testDeepKey, *int) bool { count++; return true })
+	if m.Len() != N/2 || count != N/2 {
+		t.Fatalf("invalid len %d (count=%d)", m.Len(), count)
+	}
+	for i := 0; i < N; i++ {
+		if v, ok := m.Get(testDeepKey(i)); ok != (i%2 == 0) || (ok && v != -i) {
+			t.Fatalf("invalid entry insert (i=%d)", i)
+		}
+	}
+}
@@ -25,6 +25,7 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
 	"unsafe"
 )
 
@@ -46,8 +47,8 @@ type arrkv[K ArrKey, V any] struct {
 }
 
 // NewArrMap returns an initialized map. The map value is safe to copy.
-func NewArrMap[K ArrKey, V any]() ArrMap[K, V] {
-	return ArrMap[K, V]{newRoot()}
+func NewArrMap[K ArrKey, V any](opts ...Option) ArrMap[K, V] {
+	return ArrMap[K, V]{newRoot(opts...)}
 }
 
 // Nil returns true if m is not initialized.
@@ -113,11 +114,18 @@ func (m ArrMap[K, V]) Ptr(key K) *V {
 
 // Set adds or updates the value for key.
 func (m ArrMap[K, V]) Set(key K, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m ArrMap[K, V]) Swap(key K, value V) (old V, existed bool) {
 	kb := key.KeyBytes()
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -138,8 +146,8 @@ func (m ArrMap[K, V]) Set(key K, value V) {
 		ckv := (*arrkv[K, V])(item.ptr)
 		ckey := ckv.k
 		if ckey == key { // update existing
-			ckv.v = value
-			return
+			old, ckv.v = ckv.v, value
+			return old, true
 		}
 		// rehash conflicting key
 		ckb := ckey.KeyBytes()
@@ -166,19 +174,19 @@ func (m ArrMap[K, V]) Set(key K, value V) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &arrkv[K, V]{k: key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, arrkv[K, V]{k: key, v: value})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -189,17 +197,17 @@ func (m ArrMap[K, V]) Set(key K, value V) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&arrkv[K, V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, arrkv[K, V]{k: key, v: value})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&arrkv[K, V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, arrkv[K, V]{k: key, v: value})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -208,8 +216,9 @@ func (m ArrMap[K, V]) Set(key K, value V) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
+	return // item added
 }
 
 // Mod modifies the value for key using the mod callback. The mod callback receives
@@ -219,7 +228,8 @@ func (m ArrMap[K, V]) Mod(key K, mod func(*V, bool)) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -268,24 +278,24 @@ func (m ArrMap[K, V]) Mod(key K, mod func(*V, bool)) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &arrkv[K, V]{k: key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, arrkv[K, V]{k: key})
 				mod(&kv.v, false)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
-	kv := &arrkv[K, V]{k: key}
+	kv := newItem(m.root, arrkv[K, V]{k: key})
 	mod(&kv.v, false)
 	count := uint8(bits.OnesCount32(l.pmap))
 	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
@@ -298,7 +308,7 @@ func (m ArrMap[K, V]) Mod(key K, mod func(*V, bool)) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -313,18 +323,24 @@ func (m ArrMap[K, V]) Mod(key K, mod func(*V, bool)) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
 }
 
 // Del deletes the value for key.
 func (m ArrMap[K, V]) Del(key K) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m ArrMap[K, V]) Delete(key K) (old V, existed bool) {
 	path := m.path[:0]
 	kb := key.KeyBytes()
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -346,9 +362,10 @@ func (m ArrMap[K, V]) Del(key K) {
 		if (*arrkv[K, V])(item.ptr).k != key { // key missing
 			return
 		}
+		old, existed = (*arrkv[K, V])(item.ptr).v, true
 		l.pmap &^= bit
 		l.tmap &^= bit
-		m.len--
+		m.removed(hash)
 		m.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -366,7 +383,7 @@ func (m ArrMap[K, V]) Del(key K) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = m.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -393,30 +410,323 @@ func (m ArrMap[K, V]) Del(key K) {
 		}
 		return // item removed
 	}
+	return // item missing
 }
 
 // All ranges over values in m, applying the do callback to each value until
 // the callback returns false or all values have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (m ArrMap[K, V]) All(do func(K, *V) bool) {
-	arrScan(&m.link, do)
+	arrScan(&m.link, m.order(), do)
 }
 
-func arrScan[K ArrKey, V any](l *link, do func(K, *V) bool) bool {
+func arrScan[K ArrKey, V any](l *link, rot uint64, do func(K, *V) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*arrkv[K, V])(item.ptr)
 			if !do(kv.k, &kv.v) {
 				return false
 			}
-		} else if !arrScan(item, do) {
+		} else if !arrScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// ArrMapPart is a view of the values within a contiguous range of hashes in a map.
+// A part is invalidated when the map is modified.
+type ArrMapPart[K ArrKey, V any] struct {
+	part
+}
+
+// Partition splits m into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in m. Parts agree only between maps with the seed of m, such as the copies of m
+// and the maps returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when m is modified.
+func (m ArrMap[K, V]) Partition(n uint) []ArrMapPart[K, V] {
+	return partition(m.root, n, m.itemHash, func(p part) ArrMapPart[K, V] { return ArrMapPart[K, V]{p} })
+}
+
+// PartitionFunc splits m into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in m. Unlike Partition, the part of a key depends only on
+// hash, so maps with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of m. Parts are invalidated
+// when m is modified.
+func (m ArrMap[K, V]) PartitionFunc(n uint, hash func(K) uint64) []ArrMapPart[K, V] {
+	key := func(item *link) uint64 { return hash((*arrkv[K, V])(item.ptr).k) }
+	return partitionFunc(m.root, n, key, func(p part) ArrMapPart[K, V] { return ArrMapPart[K, V]{p} })
+}
+
+// All ranges over values in p, applying the do callback to each value until
+// the callback returns false or all values have been visited.
+func (p ArrMapPart[K, V]) All(do func(K, *V) bool) {
+	p.scan(func(item *link) bool {
+		kv := (*arrkv[K, V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m ArrMap[K, V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*arrkv[K, V])(p) = arrkv[K, V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m ArrMap[K, V]) Retain(keep func(K, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*arrkv[K, V])(item.ptr)
+		return keep(kv.k, &kv.v)
+	})
+}
+
+// MapArrValues returns a new map with the keys of m, where the value for each key is the
+// result of the fn callback. The new map has the same seed and layout as m, so keys are not
+// rehashed or compared.
+func MapArrValues[K ArrKey, V, W any](m ArrMap[K, V], fn func(K, *V) W) ArrMap[K, W] {
+	return ArrMap[K, W]{m.cloneRoot(func(dst, src *link) {
+		kv := (*arrkv[K, V])(src.ptr)
+		dst.ptr = unsafe.Pointer(&arrkv[K, W]{fn(kv.k, &kv.v), kv.k})
+	})}
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed and options of m: match, containing the values for which the pred callback returns true,
+// and rest, containing all other values. Keys are not rehashed, and sub-tries are moved without
+// copying when pred returns the same result for all of their values. The pred callback must not
+// modify m.
+func (m ArrMap[K, V]) Drain(pred func(K, *V) bool) (match, rest ArrMap[K, V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		kv := (*arrkv[K, V])(item.ptr)
+		return pred(kv.k, &kv.v)
+	})
+	return ArrMap[K, V]{mr}, ArrMap[K, V]{rr}
+}
+
+// NewArrMapFrom returns an initialized map containing the key-values in src. Key-values
+// are allocated in blocks of up to 64, so each block is retained while any of its key-values
+// remain in the map. The map value is safe to copy.
+func NewArrMapFrom[K ArrKey, V any](src map[K]V, opts ...Option) ArrMap[K, V] {
+	m := NewArrMap[K, V](opts...)
+	reserveItems[arrkv[K, V]](m.root, len(src))
+	for k, v := range src {
+		m.Set(k, v)
+	}
+	m.dropReserved()
+	return m
+}
+
+// ToMap returns a builtin map containing the key-values in m.
+func (m ArrMap[K, V]) ToMap() map[K]V {
+	dst := make(map[K]V, m.len)
+	arrScan(&m.link, 0, func(k K, v *V) bool {
+		dst[k] = *v
+		return true
+	})
+	return dst
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m ArrMap[K, V]) KeySet() ArrSet[K] {
+	return ArrSet[K]{m.cloneRoot(func(dst, src *link) {
+		dst.ptr = unsafe.Pointer(&arrkv[K, struct{}]{k: (*arrkv[K, V])(src.ptr).k})
+	})}
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m ArrMap[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	m.Mod(key, func(v *V, ok bool) {
+		if !ok {
+			*v = value
+		}
+		actual, loaded = *v, ok
+	})
+	return actual, loaded
+}
+
+// CompareAndSwapFunc swaps the old and new values for key if key exists and its value
+// is equal to old, according to the eq callback. It returns true if the value was swapped.
+func (m ArrMap[K, V]) CompareAndSwapFunc(key K, old, new V, eq func(V, V) bool) (swapped bool) {
+	if v := m.Ptr(key); v != nil && eq(*v, old) {
+		*v = new
+		return true
+	}
+	return false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value and true if key
+// existed. It is equivalent to Delete.
+func (m ArrMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// PopAny removes an arbitrary key-value from m, returning the key, value, and true if m
+// was not empty.
+func (m ArrMap[K, V]) PopAny() (key K, value V, ok bool) {
+	item, ok := m.popAny(m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*arrkv[K, V])(item.ptr)
+	return kv.k, kv.v, true
+}
+
+// ArrMapEntry is a handle to the value for a key within a map, used to insert, update, or remove
+// the value without rehashing the key or repeating the traversal from the root. An entry is
+// invalidated when the map is modified other than through the entry.
+type ArrMapEntry[K ArrKey, V any] struct {
+	entry
+	kv  *arrkv[K, V]
+	key K
+	hw  maphash.Hash
+}
+
+// Entry returns an entry for key in m.
+func (m ArrMap[K, V]) Entry(key K) (e ArrMapEntry[K, V]) {
+	e.r, e.l, e.key = m.root, &m.link, key
+	kb := key.KeyBytes()
+	e.hw.SetSeed(m.seed)
+	e.hw.Write(kb[:])
+	e.h = e.hw.Sum64()
+	e.hd = e.h
+	e.radix = uint8(e.hd & 0xF)
+	for item := e.item(); item != nil; item = e.item() {
+		if e.l.tmap&(1<<e.radix) != 0 { // key-value
+			if kv := (*arrkv[K, V])(item.ptr); kv.k == key {
+				e.kv = kv
+			}
+			return e
+		}
+		if e.descend(item) { // rehash
+			e.hw.Write(kb[:])
+			e.hd = e.hw.Sum64()
+		}
+		e.radix = uint8(e.hd & 0xF)
+	}
+	return e
+}
+
+// Exists returns true if the key of e exists in the map.
+func (e *ArrMapEntry[K, V]) Exists() bool { return e.kv != nil }
+
+// Value returns a pointer to the value for the key of e, or nil if the key does not exist.
+func (e *ArrMapEntry[K, V]) Value() *V {
+	if e.kv == nil {
+		return nil
+	}
+	return &e.kv.v
+}
+
+// Insert adds or updates the value for the key of e.
+func (e *ArrMapEntry[K, V]) Insert(value V) {
+	if e.kv != nil { // update existing
+		e.kv.v = value
+		return
+	}
+	if e.stale { // traverse the modified trie
+		*e = ArrMap[K, V]{e.r}.Entry(e.key)
+	}
+	kv := newItem(e.r, arrkv[K, V]{k: e.key, v: value})
+	item := e.item()
+	if item == nil {
+		e.r.insertItem(e.l, e.d, e.radix, e.h, link{ptr: unsafe.Pointer(kv)})
+	} else { // rehash conflicting key
+		kb, ckey := e.key.KeyBytes(), (*arrkv[K, V])(item.ptr).k
+		ckb := ckey.KeyBytes()
+		var chw maphash.Hash
+		chw.SetSeed(e.r.seed)
+		for cd := uint8(0); cd <= e.d; cd += (64 / 4) {
+			chw.Write(ckb[:])
+		}
+		chd := chw.Sum64() >> (4 * (e.d % (64 / 4)))
+		e.r.branchItems(e.l, item, e.d, e.radix, e.h, e.hd, chd, func() (uint64, uint64) {
+			e.hw.Write(kb[:])
+			chw.Write(ckb[:])
+			return e.hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(kv)})
+	}
+	e.kv, e.stale = kv, true
+}
+
+// Remove deletes the value for the key of e, if the key exists.
+func (e *ArrMapEntry[K, V]) Remove() {
+	if e.stale { // traverse the modified trie
+		*e = ArrMap[K, V]{e.r}.Entry(e.key)
+	}
+	if e.kv == nil {
+		return
+	}
+	if !e.remove() {
+		ArrMap[K, V]{e.r}.Del(e.key)
+	}
+	e.kv = nil
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (m ArrMap[K, V]) itemHash(item *link) uint64 {
+	kb := (*arrkv[K, V])(item.ptr).k.KeyBytes()
+	var hw maphash.Hash
+	hw.SetSeed(m.seed)
+	hw.Write(kb[:])
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in m, and false if m is empty. The keys in m are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// m is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (m ArrMap[K, V]) RandomKey(rng *rand.Rand) (key K, ok bool) {
+	item := m.randomItem(rng, m.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*arrkv[K, V])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in m, chosen uniformly at random. If n is at most half
+// the length of m, keys are selected as in RandomKey. Otherwise m is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (m ArrMap[K, V]) Sample(n int, rng *rand.Rand) []K {
+	items := m.sample(n, rng, m.itemHash)
+	keys := make([]K, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*arrkv[K, V])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key-value from m, returning the key, value, and true
+// if m was not empty. The key-value is selected as in RandomKey, and unlinked through the path
+// traversed during selection. If rng is nil, the default source of math/rand is used.
+func (m ArrMap[K, V]) PopRandom(rng *rand.Rand) (key K, value V, ok bool) {
+	item, ok := m.popRandom(rng, m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*arrkv[K, V])(item.ptr)
+	return kv.k, kv.v, true
+}
@@ -25,6 +25,7 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
 	"unsafe"
 )
 
@@ -35,8 +36,8 @@ type ArrSet[K ArrKey] struct {
 }
 
 // NewArrSet returns an initialized set. The set value is safe to copy.
-func NewArrSet[K ArrKey]() ArrSet[K] {
-	return ArrSet[K]{newRoot()}
+func NewArrSet[K ArrKey](opts ...Option) ArrSet[K] {
+	return ArrSet[K]{newRoot(opts...)}
 }
 
 // Nil returns true if s is not initialized.
@@ -80,11 +81,17 @@ func (s ArrSet[K]) Has(key K) bool {
 
 // Add adds key to s.
 func (s ArrSet[K]) Add(key K) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s ArrSet[K]) Insert(key K) bool {
 	kb := key.KeyBytes()
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -105,7 +112,7 @@ func (s ArrSet[K]) Add(key K) {
 		ckv := (*arrkv[K, struct{}])(item.ptr)
 		ckey := ckv.k
 		if ckey == key { // exists
-			return
+			return false
 		}
 		// rehash conflicting key
 		ckb := ckey.KeyBytes()
@@ -132,19 +139,19 @@ func (s ArrSet[K]) Add(key K) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &arrkv[K, struct{}]{k: key}
+				item.ptr = s.newLinkArray(2)
+				kv := newItem(s.root, arrkv[K, struct{}]{k: key})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				s.len++
+				s.added(hash)
 				s.dep += uint64(d) * 2
-				return // key added
+				return true // key added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = s.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -155,17 +162,17 @@ func (s ArrSet[K]) Add(key K) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&arrkv[K, struct{}]{k: key}),
+			ptr: unsafe.Pointer(newItem(s.root, arrkv[K, struct{}]{k: key})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = s.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&arrkv[K, struct{}]{k: key}),
+			ptr: unsafe.Pointer(newItem(s.root, arrkv[K, struct{}]{k: key})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -174,18 +181,25 @@ func (s ArrSet[K]) Add(key K) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	s.len++
+	s.added(hash)
 	s.dep += uint64(d)
+	return true // key added
 }
 
 // Del deletes key from s.
 func (s ArrSet[K]) Del(key K) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s ArrSet[K]) Remove(key K) bool {
 	path := s.path[:0]
 	kb := key.KeyBytes()
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -205,11 +219,11 @@ func (s ArrSet[K]) Del(key K) {
 			continue
 		}
 		if (*arrkv[K, struct{}])(item.ptr).k != key { // key missing
-			return
+			return false
 		}
 		l.pmap &^= bit
 		l.tmap &^= bit
-		s.len--
+		s.removed(hash)
 		s.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -227,7 +241,7 @@ func (s ArrSet[K]) Del(key K) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = s.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -252,32 +266,171 @@ func (s ArrSet[K]) Del(key K) {
 			d--
 			path[d].link = nil
 		}
-		return // item removed
+		return true // item removed
 	}
+	return false // item missing
 }
 
 // All ranges over keys in s, applying the do callback to each key until
 // the callback returns false or all keys have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (s ArrSet[K]) All(do func(K) bool) {
-	arrSetScan(&s.link, do)
+	arrSetScan(&s.link, s.order(), do)
 }
 
-func arrSetScan[K ArrKey](l *link, do func(K) bool) bool {
+func arrSetScan[K ArrKey](l *link, rot uint64, do func(K) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*arrkv[K, struct{}])(item.ptr)
 			if !do(kv.k) {
 				return false
 			}
-		} else if !arrSetScan(item, do) {
+		} else if !arrSetScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// ArrSetPart is a view of the keys within a contiguous range of hashes in a set.
+// A part is invalidated when the set is modified.
+type ArrSetPart[K ArrKey] struct {
+	part
+}
+
+// Partition splits s into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in s. Parts agree only between sets with the seed of s, such as the copies of s
+// and the sets returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when s is modified.
+func (s ArrSet[K]) Partition(n uint) []ArrSetPart[K] {
+	return partition(s.root, n, s.itemHash, func(p part) ArrSetPart[K] { return ArrSetPart[K]{p} })
+}
+
+// PartitionFunc splits s into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in s. Unlike Partition, the part of a key depends only on
+// hash, so sets with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of s. Parts are invalidated
+// when s is modified.
+func (s ArrSet[K]) PartitionFunc(n uint, hash func(K) uint64) []ArrSetPart[K] {
+	key := func(item *link) uint64 { return hash((*arrkv[K, struct{}])(item.ptr).k) }
+	return partitionFunc(s.root, n, key, func(p part) ArrSetPart[K] { return ArrSetPart[K]{p} })
+}
+
+// All ranges over keys in p, applying the do callback to each key until
+// the callback returns false or all keys have been visited.
+func (p ArrSetPart[K]) All(do func(K) bool) {
+	p.scan(func(item *link) bool {
+		return do((*arrkv[K, struct{}])(item.ptr).k)
+	})
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays and key-values of s are retained for reuse when keys
+// are added.
+func (s ArrSet[K]) Clear() {
+	s.clear(func(p unsafe.Pointer) { *(*arrkv[K, struct{}])(p) = arrkv[K, struct{}]{} })
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s ArrSet[K]) Retain(keep func(K) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep((*arrkv[K, struct{}])(item.ptr).k)
+	})
+}
+
+// Drain moves all keys out of s, leaving s and every copy of s empty, into two new sets with the
+// seed and options of s: match, containing the keys for which the pred callback returns true, and
+// rest, containing all other keys. Keys are not rehashed, and sub-tries are moved without copying
+// when pred returns the same result for all of their keys. The pred callback must not modify s.
+func (s ArrSet[K]) Drain(pred func(K) bool) (match, rest ArrSet[K]) {
+	mr, rr := s.splitRoot(func(item *link) bool {
+		return pred((*arrkv[K, struct{}])(item.ptr).k)
+	})
+	return ArrSet[K]{mr}, ArrSet[K]{rr}
+}
+
+// NewArrSetFrom returns an initialized set containing the keys in src. Keys are allocated
+// in blocks of up to 64, so each block is retained while any of its keys remain in the set. The
+// set value is safe to copy.
+func NewArrSetFrom[K ArrKey](src []K, opts ...Option) ArrSet[K] {
+	s := NewArrSet[K](opts...)
+	reserveItems[arrkv[K, struct{}]](s.root, len(src))
+	for _, k := range src {
+		s.Add(k)
+	}
+	s.dropReserved()
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s ArrSet[K]) ToSlice() []K {
+	dst := make([]K, 0, s.len)
+	arrSetScan(&s.link, s.order(), func(k K) bool {
+		dst = append(dst, k)
+		return true
+	})
+	return dst
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (s ArrSet[K]) itemHash(item *link) uint64 {
+	kb := (*arrkv[K, struct{}])(item.ptr).k.KeyBytes()
+	var hw maphash.Hash
+	hw.SetSeed(s.seed)
+	hw.Write(kb[:])
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in s, and false if s is empty. The keys in s are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// s is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (s ArrSet[K]) RandomKey(rng *rand.Rand) (key K, ok bool) {
+	item := s.randomItem(rng, s.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*arrkv[K, struct{}])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in s, chosen uniformly at random. If n is at most half
+// the length of s, keys are selected as in RandomKey. Otherwise s is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (s ArrSet[K]) Sample(n int, rng *rand.Rand) []K {
+	items := s.sample(n, rng, s.itemHash)
+	keys := make([]K, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*arrkv[K, struct{}])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key from s, returning the key and true if s was not
+// empty. The key is selected as in RandomKey, and unlinked through the path traversed during
+// selection. If rng is nil, the default source of math/rand is used.
+func (s ArrSet[K]) PopRandom(rng *rand.Rand) (key K, ok bool) {
+	item, ok := s.popRandom(rng, s.itemHash)
+	if !ok {
+		return key, false
+	}
+	return (*arrkv[K, struct{}])(item.ptr).k, true
+}
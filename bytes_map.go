@@ -26,6 +26,8 @@ import (
 	"bytes"
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
+	"sort"
 	"unsafe"
 )
 
@@ -55,8 +57,8 @@ type byteskv[V any] struct {
 }
 
 // NewBytesMap returns an initialized map. The map value is safe to copy.
-func NewBytesMap[V any]() BytesMap[V] {
-	return BytesMap[V]{newRoot()}
+func NewBytesMap[V any](opts ...Option) BytesMap[V] {
+	return BytesMap[V]{newRoot(opts...)}
 }
 
 // Nil returns true if m is not initialized.
@@ -122,10 +124,17 @@ func (m BytesMap[V]) Ptr(key []byte) *V {
 // Set adds or updates the value for key. The key slice will be retained in m,
 // and must not be modified after the key is added.
 func (m BytesMap[V]) Set(key []byte, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed. The key slice will be retained in m, and must not be modified.
+func (m BytesMap[V]) Swap(key []byte, value V) (old V, existed bool) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -146,8 +155,8 @@ func (m BytesMap[V]) Set(key []byte, value V) {
 		ckv := (*byteskv[V])(item.ptr)
 		ckey := ckv.k
 		if bytes.Equal(ckey, key) { // update existing
-			ckv.v = value
-			return
+			old, ckv.v = ckv.v, value
+			return old, true
 		}
 		// rehash conflicting key
 		var chw maphash.Hash
@@ -157,7 +166,7 @@ func (m BytesMap[V]) Set(key []byte, value V) {
 		}
 		chd := chw.Sum64() >> (4 * (d % (64 / 4)))
 		if uint8(chd&0xF) != radix { // conflict key slice was modified
-			item.ptr = unsafe.Pointer(&byteskv[V]{value, key})
+			item.ptr = unsafe.Pointer(newItem(m.root, byteskv[V]{value, key}))
 			return
 		}
 		// replace with new branch until non-colliding
@@ -177,19 +186,19 @@ func (m BytesMap[V]) Set(key []byte, value V) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &byteskv[V]{value, key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, byteskv[V]{value, key})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -200,17 +209,17 @@ func (m BytesMap[V]) Set(key []byte, value V) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&byteskv[V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, byteskv[V]{k: key, v: value})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&byteskv[V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, byteskv[V]{k: key, v: value})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -219,8 +228,9 @@ func (m BytesMap[V]) Set(key []byte, value V) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
+	return // item added
 }
 
 // Mod modifies the value for key using the mod callback. The mod callback receives
@@ -230,7 +240,8 @@ func (m BytesMap[V]) Mod(key []byte, mod func(*V, bool)) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -262,7 +273,7 @@ func (m BytesMap[V]) Mod(key []byte, mod func(*V, bool)) {
 		}
 		chd := chw.Sum64() >> (4 * (d % (64 / 4)))
 		if uint8(chd&0xF) != radix { // conflict key slice was modified
-			kv := &byteskv[V]{k: key}
+			kv := newItem(m.root, byteskv[V]{k: key})
 			mod(&kv.v, false)
 			item.ptr = unsafe.Pointer(kv)
 			return
@@ -284,24 +295,24 @@ func (m BytesMap[V]) Mod(key []byte, mod func(*V, bool)) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &byteskv[V]{k: key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, byteskv[V]{k: key})
 				mod(&kv.v, false)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
-	kv := &byteskv[V]{k: key}
+	kv := newItem(m.root, byteskv[V]{k: key})
 	mod(&kv.v, false)
 	count := uint8(bits.OnesCount32(l.pmap))
 	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
@@ -314,7 +325,7 @@ func (m BytesMap[V]) Mod(key []byte, mod func(*V, bool)) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -329,17 +340,23 @@ func (m BytesMap[V]) Mod(key []byte, mod func(*V, bool)) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
 }
 
 // Del deletes the value for key.
 func (m BytesMap[V]) Del(key []byte) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m BytesMap[V]) Delete(key []byte) (old V, existed bool) {
 	path := m.path[:0]
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -361,9 +378,10 @@ func (m BytesMap[V]) Del(key []byte) {
 		if !bytes.Equal((*byteskv[V])(item.ptr).k, key) { // key missing
 			return
 		}
+		old, existed = (*byteskv[V])(item.ptr).v, true
 		l.pmap &^= bit
 		l.tmap &^= bit
-		m.len--
+		m.removed(hash)
 		m.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -381,7 +399,7 @@ func (m BytesMap[V]) Del(key []byte) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = m.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -408,30 +426,478 @@ func (m BytesMap[V]) Del(key []byte) {
 		}
 		return // item removed
 	}
+	return // item missing
 }
 
 // All ranges over values in m, applying the do callback to each value until
 // the callback returns false or all values have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (m BytesMap[V]) All(do func([]byte, *V) bool) {
-	bytesScan(&m.link, do)
+	bytesScan(&m.link, m.order(), do)
 }
 
-func bytesScan[V any](l *link, do func([]byte, *V) bool) bool {
+func bytesScan[V any](l *link, rot uint64, do func([]byte, *V) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*byteskv[V])(item.ptr)
 			if !do(kv.k, &kv.v) {
 				return false
 			}
-		} else if !bytesScan(item, do) {
+		} else if !bytesScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// SortedAll ranges over values in m in ascending order of keys, applying the do callback
+// to each value until the callback returns false or all values have been visited.
+// Keys are not ordered within a map, so the values of each sub-trie with up to 256 values are
+// ordered by a cursor which buffers its next 32 keys, and cursors are merged through a heap.
+// Memory is used for the cursors rather than for each value in m, and keys are not sorted before
+// the first value is visited. The do callback must not modify m.
+func (m BytesMap[V]) SortedAll(do func([]byte, *V) bool) {
+	sortedScan(&m.link, m.len, func(a, b *link) int {
+		return bytes.Compare((*byteskv[V])(a.ptr).k, (*byteskv[V])(b.ptr).k)
+	}, func(item *link) bool {
+		kv := (*byteskv[V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// SortedKeys returns the keys in m in ascending order. The returned key slices are retained
+// in m, and must not be modified.
+func (m BytesMap[V]) SortedKeys() [][]byte {
+	keys := make([][]byte, 0, m.len)
+	bytesScan(&m.link, 0, func(k []byte, _ *V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// BytesMapPart is a view of the values within a contiguous range of hashes in a map.
+// A part is invalidated when the map is modified.
+type BytesMapPart[V any] struct {
+	part
+}
+
+// Partition splits m into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in m. Parts agree only between maps with the seed of m, such as the copies of m
+// and the maps returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when m is modified.
+func (m BytesMap[V]) Partition(n uint) []BytesMapPart[V] {
+	return partition(m.root, n, m.itemHash, func(p part) BytesMapPart[V] { return BytesMapPart[V]{p} })
+}
+
+// PartitionFunc splits m into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in m. Unlike Partition, the part of a key depends only on
+// hash, so maps with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of m. Parts are invalidated
+// when m is modified.
+func (m BytesMap[V]) PartitionFunc(n uint, hash func([]byte) uint64) []BytesMapPart[V] {
+	key := func(item *link) uint64 { return hash((*byteskv[V])(item.ptr).k) }
+	return partitionFunc(m.root, n, key, func(p part) BytesMapPart[V] { return BytesMapPart[V]{p} })
+}
+
+// All ranges over values in p, applying the do callback to each value until
+// the callback returns false or all values have been visited.
+func (p BytesMapPart[V]) All(do func([]byte, *V) bool) {
+	p.scan(func(item *link) bool {
+		kv := (*byteskv[V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m BytesMap[V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*byteskv[V])(p) = byteskv[V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m BytesMap[V]) Retain(keep func([]byte, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*byteskv[V])(item.ptr)
+		return keep(kv.k, &kv.v)
+	})
+}
+
+// MapBytesValues returns a new map with the keys of m, where the value for each key is the
+// result of the fn callback. The new map has the same seed and layout as m, so keys are not
+// rehashed or compared. Key slices are shared by both maps.
+func MapBytesValues[V, W any](m BytesMap[V], fn func([]byte, *V) W) BytesMap[W] {
+	return BytesMap[W]{m.cloneRoot(func(dst, src *link) {
+		kv := (*byteskv[V])(src.ptr)
+		dst.ptr = unsafe.Pointer(&byteskv[W]{fn(kv.k, &kv.v), kv.k})
+	})}
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed and options of m: match, containing the values for which the pred callback returns true,
+// and rest, containing all other values. Keys are not rehashed, and sub-tries are moved without
+// copying when pred returns the same result for all of their values. The pred callback must not
+// modify m.
+func (m BytesMap[V]) Drain(pred func([]byte, *V) bool) (match, rest BytesMap[V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		kv := (*byteskv[V])(item.ptr)
+		return pred(kv.k, &kv.v)
+	})
+	return BytesMap[V]{mr}, BytesMap[V]{rr}
+}
+
+// NewBytesMapFrom returns an initialized map containing the key-values in src, where each
+// string key is converted to a byte slice. Key-values and key bytes are each allocated in
+// blocks of up to 64 keys, so each block is retained while any of its keys remain in the map. The
+// map value is safe to copy.
+func NewBytesMapFrom[V any](src map[string]V, opts ...Option) BytesMap[V] {
+	m := NewBytesMap[V](opts...)
+	reserveItems[byteskv[V]](m.root, len(src))
+	size := 0
+	for k := range src {
+		size += len(k)
+	}
+	block := (size/(len(src)+1) + 1) * reserveBlock // about the bytes of reserveBlock keys
+	var buf []byte
+	for k, v := range src {
+		if buf == nil || cap(buf)-len(buf) < len(k) {
+			n := block
+			if n > size {
+				n = size
+			}
+			if n < len(k) {
+				n = len(k)
+			}
+			buf = make([]byte, 0, n)
+		}
+		size -= len(k)
+		buf = append(buf, k...)
+		m.Set(buf[len(buf)-len(k):len(buf):len(buf)], v)
+	}
+	m.dropReserved()
+	return m
+}
+
+// ToMap returns a builtin map containing the key-values in m, where each key is converted
+// to a string.
+func (m BytesMap[V]) ToMap() map[string]V {
+	dst := make(map[string]V, m.len)
+	bytesScan(&m.link, 0, func(k []byte, v *V) bool {
+		dst[string(k)] = *v
+		return true
+	})
+	return dst
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared. Key slices are shared with m.
+func (m BytesMap[V]) KeySet() BytesSet {
+	return BytesSet{m.cloneRoot(func(dst, src *link) {
+		dst.ptr = unsafe.Pointer(&byteskv[struct{}]{k: (*byteskv[V])(src.ptr).k})
+	})}
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m BytesMap[V]) GetOrSet(key []byte, value V) (actual V, loaded bool) {
+	m.Mod(key, func(v *V, ok bool) {
+		if !ok {
+			*v = value
+		}
+		actual, loaded = *v, ok
+	})
+	return actual, loaded
+}
+
+// CompareAndSwapFunc swaps the old and new values for key if key exists and its value
+// is equal to old, according to the eq callback. It returns true if the value was swapped.
+func (m BytesMap[V]) CompareAndSwapFunc(key []byte, old, new V, eq func(V, V) bool) (swapped bool) {
+	if v := m.Ptr(key); v != nil && eq(*v, old) {
+		*v = new
+		return true
+	}
+	return false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value and true if key
+// existed. It is equivalent to Delete.
+func (m BytesMap[V]) LoadAndDelete(key []byte) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// PopAny removes an arbitrary key-value from m, returning the key, value, and true if m
+// was not empty.
+func (m BytesMap[V]) PopAny() (key []byte, value V, ok bool) {
+	item, ok := m.popAny(m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*byteskv[V])(item.ptr)
+	return kv.k, kv.v, true
+}
+
+// BytesMapEntry is a handle to the value for a key within a map, used to insert, update, or remove
+// the value without rehashing the key or repeating the traversal from the root. An entry is
+// invalidated when the map is modified other than through the entry.
+type BytesMapEntry[V any] struct {
+	entry
+	kv  *byteskv[V]
+	key []byte
+	hw  maphash.Hash
+}
+
+// Entry returns an entry for key in m.
+func (m BytesMap[V]) Entry(key []byte) (e BytesMapEntry[V]) {
+	e.r, e.l, e.key = m.root, &m.link, key
+	e.hw.SetSeed(m.seed)
+	e.hw.Write(key)
+	e.h = e.hw.Sum64()
+	e.hd = e.h
+	e.radix = uint8(e.hd & 0xF)
+	for item := e.item(); item != nil; item = e.item() {
+		if e.l.tmap&(1<<e.radix) != 0 { // key-value
+			if kv := (*byteskv[V])(item.ptr); bytes.Equal(kv.k, key) {
+				e.kv = kv
+			}
+			return e
+		}
+		if e.descend(item) { // rehash
+			e.hw.Write(key)
+			e.hd = e.hw.Sum64()
+		}
+		e.radix = uint8(e.hd & 0xF)
+	}
+	return e
+}
+
+// Exists returns true if the key of e exists in the map.
+func (e *BytesMapEntry[V]) Exists() bool { return e.kv != nil }
+
+// Value returns a pointer to the value for the key of e, or nil if the key does not exist.
+func (e *BytesMapEntry[V]) Value() *V {
+	if e.kv == nil {
+		return nil
+	}
+	return &e.kv.v
+}
+
+// Insert adds or updates the value for the key of e. The key slice will be retained in the
+// map, and must not be modified after the key is added.
+func (e *BytesMapEntry[V]) Insert(value V) {
+	if e.kv != nil { // update existing
+		e.kv.v = value
+		return
+	}
+	if e.stale { // traverse the modified trie
+		*e = BytesMap[V]{e.r}.Entry(e.key)
+	}
+	kv := newItem(e.r, byteskv[V]{k: e.key, v: value})
+	item := e.item()
+	if item == nil {
+		e.r.insertItem(e.l, e.d, e.radix, e.h, link{ptr: unsafe.Pointer(kv)})
+	} else { // rehash conflicting key
+		ckey := (*byteskv[V])(item.ptr).k
+		var chw maphash.Hash
+		chw.SetSeed(e.r.seed)
+		for cd := uint8(0); cd <= e.d; cd += (64 / 4) {
+			chw.Write(ckey)
+		}
+		chd := chw.Sum64() >> (4 * (e.d % (64 / 4)))
+		e.r.branchItems(e.l, item, e.d, e.radix, e.h, e.hd, chd, func() (uint64, uint64) {
+			e.hw.Write(e.key)
+			chw.Write(ckey)
+			return e.hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(kv)})
+	}
+	e.kv, e.stale = kv, true
+}
+
+// Remove deletes the value for the key of e, if the key exists.
+func (e *BytesMapEntry[V]) Remove() {
+	if e.stale { // traverse the modified trie
+		*e = BytesMap[V]{e.r}.Entry(e.key)
+	}
+	if e.kv == nil {
+		return
+	}
+	if !e.remove() {
+		BytesMap[V]{e.r}.Del(e.key)
+	}
+	e.kv = nil
+}
+
+// GetMany looks up the values for keys, storing the value for each key in values at the index
+// of the key, and true in found if found is not nil. Missing keys are assigned the zero value.
+// Keys are hashed and sorted by hash path before walking m once, so links are traversed once for
+// each common prefix. It returns the number of keys found, and panics if values or a non-nil
+// found are shorter than keys.
+func (m BytesMap[V]) GetMany(keys [][]byte, values []V, found []bool) (n int) {
+	checkMany("GetMany", len(keys), len(values), found)
+	values = values[:len(keys)]
+	if found != nil {
+		found = found[:len(keys)]
+	}
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		var v *V
+		if item, _, ok := b.next(bk.path); !ok {
+			v = m.Ptr(key)
+		} else if item != nil {
+			if kv := (*byteskv[V])(item.ptr); bytes.Equal(kv.k, key) {
+				v = &kv.v
+			}
+		}
+		if v != nil {
+			values[bk.i] = *v
+			n++
+		} else {
+			var zero V
+			values[bk.i] = zero
+		}
+		if found != nil {
+			found[bk.i] = v != nil
+		}
+	}
+	return n
+}
+
+// SetMany adds or updates the value for each key to the value in values at the index of the key,
+// as if Set were called for each key in order. Keys are hashed and sorted by hash path before
+// walking m once. It panics if values is shorter than keys. The key slices will be retained
+// in m, and must not be modified after the keys are added.
+func (m BytesMap[V]) SetMany(keys [][]byte, values []V) {
+	checkMany("SetMany", len(keys), len(values), nil)
+	values = values[:len(keys)]
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key, value := keys[bk.i], values[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			m.Set(key, value)
+			b.reset()
+			continue
+		}
+		if item == nil {
+			b.insert(d, link{ptr: unsafe.Pointer(newItem(m.root, byteskv[V]{k: key, v: value}))})
+			continue
+		}
+		if kv := (*byteskv[V])(item.ptr); bytes.Equal(kv.k, key) { // update existing
+			kv.v = value
+			continue
+		}
+		// rehash conflicting key
+		ckey := (*byteskv[V])(item.ptr).k
+		var hw, chw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(key)
+		chw.SetSeed(m.seed)
+		chw.Write(ckey)
+		b.branch(item, d, bk.hash>>(4*d), chw.Sum64()>>(4*d), func() (uint64, uint64) {
+			hw.Write(key)
+			chw.Write(ckey)
+			return hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(newItem(m.root, byteskv[V]{k: key, v: value}))})
+	}
+}
+
+// DelMany deletes the values for keys. Keys are hashed and sorted by hash path before walking
+// m once. It returns the number of values deleted.
+func (m BytesMap[V]) DelMany(keys [][]byte) (n int) {
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			if _, ok := m.Delete(key); ok {
+				n++
+			}
+			b.reset()
+		} else if item != nil && bytes.Equal((*byteskv[V])(item.ptr).k, key) {
+			b.remove(d)
+			n++
+		}
+	}
+	return n
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (m BytesMap[V]) itemHash(item *link) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(m.seed)
+	hw.Write((*byteskv[V])(item.ptr).k)
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in m, and false if m is empty. The keys in m are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// m is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (m BytesMap[V]) RandomKey(rng *rand.Rand) (key []byte, ok bool) {
+	item := m.randomItem(rng, m.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*byteskv[V])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in m, chosen uniformly at random. If n is at most half
+// the length of m, keys are selected as in RandomKey. Otherwise m is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (m BytesMap[V]) Sample(n int, rng *rand.Rand) [][]byte {
+	items := m.sample(n, rng, m.itemHash)
+	keys := make([][]byte, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*byteskv[V])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key-value from m, returning the key, value, and true
+// if m was not empty. The key-value is selected as in RandomKey, and unlinked through the path
+// traversed during selection. If rng is nil, the default source of math/rand is used.
+func (m BytesMap[V]) PopRandom(rng *rand.Rand) (key []byte, value V, ok bool) {
+	item, ok := m.popRandom(rng, m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*byteskv[V])(item.ptr)
+	return kv.k, kv.v, true
+}
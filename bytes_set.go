@@ -26,6 +26,7 @@ import (
 	"bytes"
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
 	"unsafe"
 )
 
@@ -37,8 +38,8 @@ type BytesSet struct {
 }
 
 // NewBytesSet returns an initialized set. The set value is safe to copy.
-func NewBytesSet() BytesSet {
-	return BytesSet{newRoot()}
+func NewBytesSet(opts ...Option) BytesSet {
+	return BytesSet{newRoot(opts...)}
 }
 
 // Nil returns true if s is not initialized.
@@ -82,10 +83,17 @@ func (s BytesSet) Has(key []byte) bool {
 // Add adds key to s. The key slice will be retained in s, and must not be
 // modified after the key is added.
 func (s BytesSet) Add(key []byte) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed. The key
+// slice will be retained in s, and must not be modified.
+func (s BytesSet) Insert(key []byte) bool {
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(key)
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -106,7 +114,7 @@ func (s BytesSet) Add(key []byte) {
 		ckv := (*byteskv[struct{}])(item.ptr)
 		ckey := ckv.k
 		if bytes.Equal(ckey, key) { // exists
-			return
+			return false
 		}
 		// rehash conflicting key
 		var chw maphash.Hash
@@ -132,19 +140,19 @@ func (s BytesSet) Add(key []byte) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &byteskv[struct{}]{k: key}
+				item.ptr = s.newLinkArray(2)
+				kv := newItem(s.root, byteskv[struct{}]{k: key})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				s.len++
+				s.added(hash)
 				s.dep += uint64(d) * 2
-				return // key added
+				return true // key added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = s.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -155,17 +163,17 @@ func (s BytesSet) Add(key []byte) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&byteskv[struct{}]{k: key}),
+			ptr: unsafe.Pointer(newItem(s.root, byteskv[struct{}]{k: key})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = s.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&byteskv[struct{}]{k: key}),
+			ptr: unsafe.Pointer(newItem(s.root, byteskv[struct{}]{k: key})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -174,17 +182,24 @@ func (s BytesSet) Add(key []byte) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	s.len++
+	s.added(hash)
 	s.dep += uint64(d)
+	return true // key added
 }
 
 // Del deletes key from s.
 func (s BytesSet) Del(key []byte) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s BytesSet) Remove(key []byte) bool {
 	path := s.path[:0]
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(key)
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -203,12 +218,12 @@ func (s BytesSet) Del(key []byte) {
 			bit, idx = 1<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 			continue
 		}
-		if bytes.Equal((*byteskv[struct{}])(item.ptr).k, key) { // key missing
-			return
+		if !bytes.Equal((*byteskv[struct{}])(item.ptr).k, key) { // key missing
+			return false
 		}
 		l.pmap &^= bit
 		l.tmap &^= bit
-		s.len--
+		s.removed(hash)
 		s.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -226,7 +241,7 @@ func (s BytesSet) Del(key []byte) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = s.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -251,32 +266,171 @@ func (s BytesSet) Del(key []byte) {
 			d--
 			path[d].link = nil
 		}
-		return // item removed
+		return true // item removed
 	}
+	return false // item missing
 }
 
 // All ranges over keys in s, applying the do callback to each key until
 // the callback returns false or all keys have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (s BytesSet) All(do func([]byte) bool) {
-	bytesSetScan(&s.link, do)
+	bytesSetScan(&s.link, s.order(), do)
 }
 
-func bytesSetScan(l *link, do func([]byte) bool) bool {
+func bytesSetScan(l *link, rot uint64, do func([]byte) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*byteskv[struct{}])(item.ptr)
 			if !do(kv.k) {
 				return false
 			}
-		} else if !bytesSetScan(item, do) {
+		} else if !bytesSetScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// BytesSetPart is a view of the keys within a contiguous range of hashes in a set.
+// A part is invalidated when the set is modified.
+type BytesSetPart struct {
+	part
+}
+
+// Partition splits s into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in s. Parts agree only between sets with the seed of s, such as the copies of s
+// and the sets returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when s is modified.
+func (s BytesSet) Partition(n uint) []BytesSetPart {
+	return partition(s.root, n, s.itemHash, func(p part) BytesSetPart { return BytesSetPart{p} })
+}
+
+// PartitionFunc splits s into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in s. Unlike Partition, the part of a key depends only on
+// hash, so sets with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of s. Parts are invalidated
+// when s is modified.
+func (s BytesSet) PartitionFunc(n uint, hash func([]byte) uint64) []BytesSetPart {
+	key := func(item *link) uint64 { return hash((*byteskv[struct{}])(item.ptr).k) }
+	return partitionFunc(s.root, n, key, func(p part) BytesSetPart { return BytesSetPart{p} })
+}
+
+// All ranges over keys in p, applying the do callback to each key until
+// the callback returns false or all keys have been visited.
+func (p BytesSetPart) All(do func([]byte) bool) {
+	p.scan(func(item *link) bool {
+		return do((*byteskv[struct{}])(item.ptr).k)
+	})
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays and key-values of s are retained for reuse when keys
+// are added.
+func (s BytesSet) Clear() {
+	s.clear(func(p unsafe.Pointer) { *(*byteskv[struct{}])(p) = byteskv[struct{}]{} })
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s BytesSet) Retain(keep func([]byte) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep((*byteskv[struct{}])(item.ptr).k)
+	})
+}
+
+// Drain moves all keys out of s, leaving s and every copy of s empty, into two new sets with the
+// seed and options of s: match, containing the keys for which the pred callback returns true, and
+// rest, containing all other keys. Keys are not rehashed, and sub-tries are moved without copying
+// when pred returns the same result for all of their keys. The pred callback must not modify s.
+func (s BytesSet) Drain(pred func([]byte) bool) (match, rest BytesSet) {
+	mr, rr := s.splitRoot(func(item *link) bool {
+		return pred((*byteskv[struct{}])(item.ptr).k)
+	})
+	return BytesSet{mr}, BytesSet{rr}
+}
+
+// NewBytesSetFrom returns an initialized set containing the keys in src. Keys are allocated
+// in blocks of up to 64, so each block is retained while any of its keys remain in the set. The
+// set value is safe to copy.
+func NewBytesSetFrom(src [][]byte, opts ...Option) BytesSet {
+	s := NewBytesSet(opts...)
+	reserveItems[byteskv[struct{}]](s.root, len(src))
+	for _, k := range src {
+		s.Add(k)
+	}
+	s.dropReserved()
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All. The returned key slices
+// are retained in s, and must not be modified.
+func (s BytesSet) ToSlice() [][]byte {
+	dst := make([][]byte, 0, s.len)
+	bytesSetScan(&s.link, s.order(), func(k []byte) bool {
+		dst = append(dst, k)
+		return true
+	})
+	return dst
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (s BytesSet) itemHash(item *link) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(s.seed)
+	hw.Write((*byteskv[struct{}])(item.ptr).k)
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in s, and false if s is empty. The keys in s are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// s is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (s BytesSet) RandomKey(rng *rand.Rand) (key []byte, ok bool) {
+	item := s.randomItem(rng, s.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*byteskv[struct{}])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in s, chosen uniformly at random. If n is at most half
+// the length of s, keys are selected as in RandomKey. Otherwise s is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (s BytesSet) Sample(n int, rng *rand.Rand) [][]byte {
+	items := s.sample(n, rng, s.itemHash)
+	keys := make([][]byte, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*byteskv[struct{}])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key from s, returning the key and true if s was not
+// empty. The key is selected as in RandomKey, and unlinked through the path traversed during
+// selection. If rng is nil, the default source of math/rand is used.
+func (s BytesSet) PopRandom(rng *rand.Rand) (key []byte, ok bool) {
+	item, ok := s.popRandom(rng, s.itemHash)
+	if !ok {
+		return key, false
+	}
+	return (*byteskv[struct{}])(item.ptr).k, true
+}
@@ -0,0 +1,46 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build !go1.24
+
+package amt
+
+import (
+	"hash/maphash"
+	"reflect"
+)
+
+// hashComparable returns the hash of key for iter, as in Key.Hash. Toolchains before Go 1.24 do
+// not provide maphash.WriteComparable, so key is hashed by walking its value with reflection.
+// The bytes of key can not be hashed directly, as values which are equal under == need not have
+// equal bytes (strings, interfaces, and signed zeros), and the hash functions of the runtime are
+// not exported, so reflection is the only portable way to reach the fields of an arbitrary key.
+// Values which are equal under == are hashed identically.
+func hashComparable[K comparable](seed maphash.Seed, key K, iter uint) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(seed)
+	v := reflect.ValueOf(&key).Elem()
+	for i := uint(0); i <= iter; i++ {
+		writeComparable(&hw, v)
+	}
+	return hw.Sum64()
+}
@@ -0,0 +1,164 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import "hash/maphash"
+
+// comparableKey adapts a comparable type to the Key interface, for ComparableMap[K, V] and
+// ComparableSet[K].
+type comparableKey[K comparable] struct {
+	k K
+}
+
+func (k comparableKey[K]) Equal(k2 comparableKey[K]) bool { return k.k == k2.k }
+
+func (k comparableKey[K]) Hash(seed maphash.Seed, iter uint) uint64 {
+	return hashComparable(seed, k.k, iter)
+}
+
+// ComparableMap maps keys of any comparable type to values. Keys are compared with == and
+// hashed automatically, so key types do not need to implement Key. Key types containing interfaces
+// satisfy comparable only in modules using Go 1.20 or later. Methods on a map value will panic if
+// the map is not initialized. A map value is safe to copy.
+type ComparableMap[K comparable, V any] struct {
+	*root
+}
+
+// NewComparableMap returns an initialized map. The map value is safe to copy.
+func NewComparableMap[K comparable, V any](opts ...Option) ComparableMap[K, V] {
+	return ComparableMap[K, V]{newRoot(opts...)}
+}
+
+// NewComparableMapFrom returns an initialized map containing the key-values in src. Key-values
+// are allocated in blocks of up to 64, so each block is retained while any of its key-values
+// remain in the map. The map value is safe to copy.
+func NewComparableMapFrom[K comparable, V any](src map[K]V, opts ...Option) ComparableMap[K, V] {
+	m := NewComparableMap[K, V](opts...)
+	reserveItems[kv[comparableKey[K], V]](m.root, len(src))
+	for k, v := range src {
+		m.Set(k, v)
+	}
+	m.dropReserved()
+	return m
+}
+
+func (m ComparableMap[K, V]) keyed() Map[comparableKey[K], V] {
+	return Map[comparableKey[K], V]{m.root}
+}
+
+// Nil returns true if m is not initialized.
+func (m ComparableMap[K, V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m ComparableMap[K, V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m ComparableMap[K, V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m ComparableMap[K, V]) Get(key K) (value V, ok bool) {
+	return m.keyed().Get(comparableKey[K]{key})
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m ComparableMap[K, V]) Val(key K) (value V) {
+	return m.keyed().Val(comparableKey[K]{key})
+}
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m ComparableMap[K, V]) Ptr(key K) *V {
+	return m.keyed().Ptr(comparableKey[K]{key})
+}
+
+// Set adds or updates the value for key.
+func (m ComparableMap[K, V]) Set(key K, value V) {
+	m.keyed().Swap(comparableKey[K]{key}, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m ComparableMap[K, V]) Swap(key K, value V) (old V, existed bool) {
+	return m.keyed().Swap(comparableKey[K]{key}, value)
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed.
+func (m ComparableMap[K, V]) Mod(key K, mod func(*V, bool)) {
+	m.keyed().Mod(comparableKey[K]{key}, mod)
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m ComparableMap[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	return m.keyed().GetOrSet(comparableKey[K]{key}, value)
+}
+
+// Del deletes the value for key.
+func (m ComparableMap[K, V]) Del(key K) {
+	m.keyed().Delete(comparableKey[K]{key})
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m ComparableMap[K, V]) Delete(key K) (old V, existed bool) {
+	return m.keyed().Delete(comparableKey[K]{key})
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m ComparableMap[K, V]) All(do func(K, *V) bool) {
+	mapScan(&m.link, m.order(), func(k comparableKey[K], v *V) bool { return do(k.k, v) })
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m ComparableMap[K, V]) Clear() {
+	m.keyed().Clear()
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m ComparableMap[K, V]) Retain(keep func(K, *V) bool) {
+	m.keyed().Retain(func(k comparableKey[K], v *V) bool { return keep(k.k, v) })
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m ComparableMap[K, V]) KeySet() ComparableSet[K] {
+	return ComparableSet[K]{m.keyed().KeySet().root}
+}
+
+// ToMap returns a builtin map containing the key-values in m.
+func (m ComparableMap[K, V]) ToMap() map[K]V {
+	dst := make(map[K]V, m.len)
+	mapScan(&m.link, 0, func(k comparableKey[K], v *V) bool {
+		dst[k.k] = *v
+		return true
+	})
+	return dst
+}
@@ -0,0 +1,119 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+// ComparableSet contains a set of keys of any comparable type. Keys are compared with == and
+// hashed automatically, so key types do not need to implement Key. Key types containing interfaces
+// satisfy comparable only in modules using Go 1.20 or later. Methods on a set value will panic if
+// the set is not initialized. A set value is safe to copy.
+type ComparableSet[K comparable] struct {
+	*root
+}
+
+// NewComparableSet returns an initialized set. The set value is safe to copy.
+func NewComparableSet[K comparable](opts ...Option) ComparableSet[K] {
+	return ComparableSet[K]{newRoot(opts...)}
+}
+
+// NewComparableSetFrom returns an initialized set containing the keys in src. Keys are allocated
+// in blocks of up to 64, so each block is retained while any of its keys remain in the set. The
+// set value is safe to copy.
+func NewComparableSetFrom[K comparable](src []K, opts ...Option) ComparableSet[K] {
+	s := NewComparableSet[K](opts...)
+	reserveItems[kv[comparableKey[K], struct{}]](s.root, len(src))
+	for _, k := range src {
+		s.Add(k)
+	}
+	s.dropReserved()
+	return s
+}
+
+func (s ComparableSet[K]) keyed() Set[comparableKey[K]] {
+	return Set[comparableKey[K]]{s.root}
+}
+
+// Nil returns true if s is not initialized.
+func (s ComparableSet[K]) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s ComparableSet[K]) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s ComparableSet[K]) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if s contains key.
+func (s ComparableSet[K]) Has(key K) bool {
+	return s.keyed().Has(comparableKey[K]{key})
+}
+
+// Add adds key to s.
+func (s ComparableSet[K]) Add(key K) {
+	s.keyed().Insert(comparableKey[K]{key})
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s ComparableSet[K]) Insert(key K) bool {
+	return s.keyed().Insert(comparableKey[K]{key})
+}
+
+// Del deletes key from s.
+func (s ComparableSet[K]) Del(key K) {
+	s.keyed().Remove(comparableKey[K]{key})
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s ComparableSet[K]) Remove(key K) bool {
+	return s.keyed().Remove(comparableKey[K]{key})
+}
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s ComparableSet[K]) All(do func(K) bool) {
+	setScan(&s.link, s.order(), func(k comparableKey[K]) bool { return do(k.k) })
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays and key-values of s are retained for reuse when keys
+// are added.
+func (s ComparableSet[K]) Clear() {
+	s.keyed().Clear()
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s ComparableSet[K]) Retain(keep func(K) bool) {
+	s.keyed().Retain(func(k comparableKey[K]) bool { return keep(k.k) })
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s ComparableSet[K]) ToSlice() []K {
+	dst := make([]K, 0, s.len)
+	setScan(&s.link, s.order(), func(k comparableKey[K]) bool {
+		dst = append(dst, k.k)
+		return true
+	})
+	return dst
+}
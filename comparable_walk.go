@@ -0,0 +1,94 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build !go1.24
+
+package amt
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+)
+
+// writeComparable writes the value of v to hw, such that values which are equal under == are
+// written identically. Blank fields of structs are skipped, as they are ignored by ==. It is used
+// by hashComparable for toolchains before Go 1.24.
+func writeComparable(hw *maphash.Hash, v reflect.Value) {
+	var b [8]byte
+	write := func(u uint64) {
+		for i := range b {
+			b[i] = byte(u >> (8 * i))
+		}
+		hw.Write(b[:])
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			write(1)
+		} else {
+			write(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		write(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		write(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeFloat(write, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeFloat(write, real(c))
+		writeFloat(write, imag(c))
+	case reflect.String:
+		hw.WriteString(v.String())
+		write(uint64(v.Len()))
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		write(uint64(v.Pointer()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeComparable(hw, v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).Name != "_" {
+				writeComparable(hw, v.Field(i))
+			}
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			write(0)
+			return
+		}
+		e := v.Elem()
+		hw.WriteString(e.Type().String())
+		writeComparable(hw, e)
+	}
+}
+
+// writeFloat writes f such that positive and negative zero are hashed identically.
+func writeFloat(write func(uint64), f float64) {
+	if f == 0 {
+		f = 0
+	}
+	write(math.Float64bits(f))
+}
@@ -0,0 +1,185 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Float64Map maps floating-point numbers to values. The bits of each key are stored inline
+// within each leaf link, with the layout and hashing of IntMap[V]. Negative zero and positive
+// zero are a single key. As in builtin maps, NaN keys never match any key, so each NaN key
+// which is set is added as a new key, which is visited by All and counted by Len but cannot be
+// found, updated or deleted by key. If the TotalOrder option was given during initialization,
+// all NaN values are a single key. Methods on a map value will panic if the map is not
+// initialized. A map value is safe to copy.
+type Float64Map[V any] struct {
+	*root
+}
+
+// NewFloat64Map returns an initialized map. The map value is safe to copy.
+func NewFloat64Map[V any](opts ...Option) Float64Map[V] {
+	return Float64Map[V]{newRoot(opts...)}
+}
+
+func (m Float64Map[V]) ints() IntMap[V] { return IntMap[V]{m.root} }
+
+// floatKey returns the canonical bits of key, or false if key is NaN and the TotalOrder
+// option was not given.
+func floatKey(opts Option, key float64) (IntKey, bool) {
+	switch {
+	case key == 0: // negative zero
+		return 0, true
+	case key != key: // NaN
+		if opts&TotalOrder == 0 {
+			return 0, false
+		}
+		key = math.NaN()
+	}
+	return IntKey(math.Float64bits(key)), true
+}
+
+// floatSetKey returns the bits under which key is set in r. If key is NaN and the TotalOrder
+// option was not given, floatSetKey returns bits which are not present in r: the bits of key
+// if they are not present, or otherwise a quiet NaN with a random payload.
+func floatSetKey(r *root, key float64) IntKey {
+	if k, ok := floatKey(r.opts, key); ok {
+		return k
+	}
+	k := IntKey(math.Float64bits(key))
+	for (IntSet{r}).Has(k) {
+		k = IntKey(0x7FF8<<48 | rand.Uint64()&(1<<51-1))
+	}
+	return k
+}
+
+// Nil returns true if m is not initialized.
+func (m Float64Map[V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m Float64Map[V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m Float64Map[V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m Float64Map[V]) Get(key float64) (value V, ok bool) {
+	if ptr := m.Ptr(key); ptr != nil {
+		value, ok = *ptr, true
+	}
+	return
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m Float64Map[V]) Val(key float64) (value V) {
+	if m.root != nil {
+		if ptr := m.Ptr(key); ptr != nil {
+			value = *ptr
+		}
+	}
+	return
+}
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m Float64Map[V]) Ptr(key float64) *V {
+	if k, ok := floatKey(m.opts, key); ok {
+		return m.ints().Ptr(k)
+	}
+	return nil
+}
+
+// Set adds or updates the value for key.
+func (m Float64Map[V]) Set(key float64, value V) { m.Swap(key, value) }
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed. If key is NaN and m was not initialized with the TotalOrder option, value
+// is added under a new key, and Swap returns a zero value and false.
+func (m Float64Map[V]) Swap(key float64, value V) (old V, existed bool) {
+	return m.ints().Swap(floatSetKey(m.root, key), value)
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed. If key
+// is NaN and m was not initialized with the TotalOrder option, the mod callback receives
+// a pointer to the value of a new key and false.
+func (m Float64Map[V]) Mod(key float64, mod func(*V, bool)) {
+	m.ints().Mod(floatSetKey(m.root, key), mod)
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false. If key is NaN and m was not initialized with the TotalOrder
+// option, value is always set under a new key.
+func (m Float64Map[V]) GetOrSet(key float64, value V) (actual V, loaded bool) {
+	return m.ints().GetOrSet(floatSetKey(m.root, key), value)
+}
+
+// Del deletes the value for key.
+func (m Float64Map[V]) Del(key float64) { m.Delete(key) }
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m Float64Map[V]) Delete(key float64) (old V, existed bool) {
+	if k, ok := floatKey(m.opts, key); ok {
+		return m.ints().Delete(k)
+	}
+	return old, false
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m Float64Map[V]) All(do func(float64, *V) bool) {
+	intScan(&m.link, m.order(), func(k IntKey, v *V) bool { return do(math.Float64frombits(uint64(k)), v) })
+}
+
+// SortedKeys returns the keys in m in ascending order, with NaN ordered before other values
+// as in sort.Float64s.
+func (m Float64Map[V]) SortedKeys() []float64 {
+	keys := make([]float64, 0, m.len)
+	intScan(&m.link, 0, func(k IntKey, _ *V) bool {
+		keys = append(keys, math.Float64frombits(uint64(k)))
+		return true
+	})
+	sort.Float64s(keys)
+	return keys
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m Float64Map[V]) Clear() { m.ints().Clear() }
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m Float64Map[V]) Retain(keep func(float64, *V) bool) {
+	m.ints().Retain(func(k IntKey, v *V) bool { return keep(math.Float64frombits(uint64(k)), v) })
+}
+
+// KeySet returns a new set containing the keys of m, with the options of m. The new set has
+// the same seed and layout as m, so keys are not rehashed or compared.
+func (m Float64Map[V]) KeySet() Float64Set { return Float64Set{m.ints().KeySet().root} }
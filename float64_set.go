@@ -0,0 +1,126 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"math"
+	"sort"
+)
+
+// Float64Set contains a set of floating-point numbers. The bits of each key are stored inline
+// within each leaf link, with the layout and hashing of IntSet. Keys are compared as in
+// Float64Map[V], according to the TotalOrder option, so without TotalOrder each NaN key which
+// is added is a new key. Methods on a set value will panic if the set
+// is not initialized. A set value is safe to copy.
+type Float64Set struct {
+	*root
+}
+
+// NewFloat64Set returns an initialized set. The set value is safe to copy.
+func NewFloat64Set(opts ...Option) Float64Set {
+	return Float64Set{newRoot(opts...)}
+}
+
+func (s Float64Set) ints() IntSet { return IntSet{s.root} }
+
+// Nil returns true if s is not initialized.
+func (s Float64Set) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s Float64Set) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s Float64Set) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if s contains key.
+func (s Float64Set) Has(key float64) bool {
+	k, ok := floatKey(s.opts, key)
+	return ok && s.ints().Has(k)
+}
+
+// Add adds key to s.
+func (s Float64Set) Add(key float64) { s.Insert(key) }
+
+// Insert adds key to s, returning true if key was added or false if key existed. If key is
+// NaN and s was not initialized with the TotalOrder option, key is always added.
+func (s Float64Set) Insert(key float64) bool { return s.ints().Insert(floatSetKey(s.root, key)) }
+
+// Del deletes key from s.
+func (s Float64Set) Del(key float64) { s.Remove(key) }
+
+// Remove deletes key from s, returning true if key existed.
+func (s Float64Set) Remove(key float64) bool {
+	k, ok := floatKey(s.opts, key)
+	return ok && s.ints().Remove(k)
+}
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s Float64Set) All(do func(float64) bool) {
+	intSetScan(&s.link, s.order(), func(k IntKey) bool { return do(math.Float64frombits(uint64(k))) })
+}
+
+// SortedKeys returns the keys in s in ascending order, with NaN ordered before other values
+// as in sort.Float64s.
+func (s Float64Set) SortedKeys() []float64 {
+	keys := make([]float64, 0, s.len)
+	intSetScan(&s.link, 0, func(k IntKey) bool {
+		keys = append(keys, math.Float64frombits(uint64(k)))
+		return true
+	})
+	sort.Float64s(keys)
+	return keys
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays of s are retained for reuse when keys are added.
+func (s Float64Set) Clear() { s.ints().Clear() }
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s Float64Set) Retain(keep func(float64) bool) {
+	s.ints().Retain(func(k IntKey) bool { return keep(math.Float64frombits(uint64(k))) })
+}
+
+// NewFloat64SetFrom returns an initialized set containing the keys in src. Keys are stored
+// inline, so no key-values are allocated. The set value is safe to copy.
+func NewFloat64SetFrom(src []float64, opts ...Option) Float64Set {
+	s := NewFloat64Set(opts...)
+	for _, k := range src {
+		s.Add(k)
+	}
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s Float64Set) ToSlice() []float64 {
+	dst := make([]float64, 0, s.len)
+	intSetScan(&s.link, s.order(), func(k IntKey) bool {
+		dst = append(dst, math.Float64frombits(uint64(k)))
+		return true
+	})
+	return dst
+}
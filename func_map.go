@@ -0,0 +1,317 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"unsafe"
+)
+
+// FuncMap maps keys to values using the hash and equality functions given during
+// initialization, so keys of any type may be used without implementing Key[K]. The functions
+// are stored within the root of the map, alongside its seed. Methods on a map value will panic
+// if the map is not initialized. A map value is safe to copy.
+type FuncMap[K, V any] struct {
+	*root
+}
+
+// keyFuncs contains the hash and equality functions for the keys of a FuncMap or FuncSet.
+type keyFuncs[K any] struct {
+	hash  func(seed maphash.Seed, key K, iter uint) uint64
+	equal func(a, b K) bool
+}
+
+type funckv[K, V any] struct {
+	v V
+	k K
+}
+
+// NewMapFunc returns an initialized map which hashes and compares keys with the hash and equal
+// functions. The hash function must hash the key 1 or more times, as in Key[K].Hash, and must
+// return equal hashes for keys which are equal according to the equal function. The map value
+// is safe to copy.
+func NewMapFunc[K, V any](hash func(seed maphash.Seed, key K, iter uint) uint64, equal func(a, b K) bool, opts ...Option) FuncMap[K, V] {
+	return FuncMap[K, V]{newFuncRoot(hash, equal, opts...)}
+}
+
+// newFuncRoot returns a new root containing the hash and equal functions for keys.
+func newFuncRoot[K any](hash func(seed maphash.Seed, key K, iter uint) uint64, equal func(a, b K) bool, opts ...Option) *root {
+	r := newRoot(opts...)
+	r.funcs = unsafe.Pointer(&keyFuncs[K]{hash, equal})
+	return r
+}
+
+// keyFuncsOf returns the key functions stored within r.
+func keyFuncsOf[K any](r *root) *keyFuncs[K] { return (*keyFuncs[K])(r.funcs) }
+
+// findFunc returns the key-value link for key within r, or nil if key is missing.
+func findFunc[K, V any](r *root, key K) *link {
+	f := keyFuncsOf[K](r)
+	hd, l, d := f.hash(r.seed, key, 0), &r.link, uint8(0)
+	for {
+		bit := uint32(1) << uint8(hd&0xF)
+		if l.pmap&bit == 0 { // item missing
+			return nil
+		}
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			if f.equal(key, (*funckv[K, V])(item.ptr).k) { // key match
+				return item
+			}
+			return nil // key mismatch
+		}
+		l = item // traverse branch
+		d++
+		if d&0xF != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = f.hash(r.seed, key, uint(d>>4))
+		}
+	}
+}
+
+// insertFunc returns the key-value for key within r and true if key exists. Otherwise,
+// it inserts and returns a zero value for key and false.
+func insertFunc[K, V any](r *root, key K) (*funckv[K, V], bool) {
+	f := keyFuncsOf[K](r)
+	hash := f.hash(r.seed, key, 0)
+	hd, l, d := hash, &r.link, uint8(0)
+	for {
+		radix := uint8(hd & 0xF)
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 { // item missing
+			kv := newItem(r, funckv[K, V]{k: key})
+			r.insertItem(l, d, radix, hash, link{ptr: unsafe.Pointer(kv)})
+			return kv, false
+		}
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			ckey := (*funckv[K, V])(item.ptr).k
+			if f.equal(key, ckey) { // key exists
+				return (*funckv[K, V])(item.ptr), true
+			}
+			// rehash conflicting key
+			iter := uint(d >> 4)
+			chd := f.hash(r.seed, ckey, iter) >> (4 * (d & 0xF))
+			kv := newItem(r, funckv[K, V]{k: key})
+			r.branchItems(l, item, d, radix, hash, hd, chd, func() (uint64, uint64) {
+				iter++
+				return f.hash(r.seed, key, iter), f.hash(r.seed, ckey, iter)
+			}, link{ptr: unsafe.Pointer(kv)})
+			return kv, false
+		}
+		l = item // traverse branch
+		d++
+		if d&0xF != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = f.hash(r.seed, key, uint(d>>4))
+		}
+	}
+}
+
+// removeFunc removes the key-value for key within r, returning the removed key-value and
+// true if key existed.
+func removeFunc[K, V any](r *root, key K) (*funckv[K, V], bool) {
+	f := keyFuncsOf[K](r)
+	path := r.path[:0]
+	hash := f.hash(r.seed, key, 0)
+	hd, l, d := hash, &r.link, uint8(0)
+	for {
+		radix := uint8(hd & 0xF)
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 { // item missing
+			return nil, false
+		}
+		path = append(path, pathLink{radix, l})
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			kv := (*funckv[K, V])(item.ptr)
+			if !f.equal(key, kv.k) { // key missing
+				return nil, false
+			}
+			r.unlink(path, d, hash)
+			return kv, true
+		}
+		l = item // traverse branch
+		d++
+		if d&0xF != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = f.hash(r.seed, key, uint(d>>4))
+		}
+	}
+}
+
+// Nil returns true if m is not initialized.
+func (m FuncMap[K, V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m FuncMap[K, V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m FuncMap[K, V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m FuncMap[K, V]) Get(key K) (value V, ok bool) {
+	if ptr := m.Ptr(key); ptr != nil {
+		value, ok = *ptr, true
+	}
+	return
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m FuncMap[K, V]) Val(key K) (value V) {
+	if m.root != nil {
+		if ptr := m.Ptr(key); ptr != nil {
+			value = *ptr
+		}
+	}
+	return
+}
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m FuncMap[K, V]) Ptr(key K) *V {
+	if item := findFunc[K, V](m.root, key); item != nil {
+		return &(*funckv[K, V])(item.ptr).v
+	}
+	return nil
+}
+
+// Set adds or updates the value for key.
+func (m FuncMap[K, V]) Set(key K, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m FuncMap[K, V]) Swap(key K, value V) (old V, existed bool) {
+	kv, existed := insertFunc[K, V](m.root, key)
+	old, kv.v = kv.v, value
+	return old, existed
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed.
+func (m FuncMap[K, V]) Mod(key K, mod func(*V, bool)) {
+	kv, existed := insertFunc[K, V](m.root, key)
+	mod(&kv.v, existed)
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m FuncMap[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	kv, loaded := insertFunc[K, V](m.root, key)
+	if !loaded {
+		kv.v = value
+	}
+	return kv.v, loaded
+}
+
+// Del deletes the value for key.
+func (m FuncMap[K, V]) Del(key K) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m FuncMap[K, V]) Delete(key K) (old V, existed bool) {
+	if kv, ok := removeFunc[K, V](m.root, key); ok {
+		return kv.v, true
+	}
+	return old, false
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m FuncMap[K, V]) All(do func(K, *V) bool) {
+	funcScan(&m.link, m.order(), do)
+}
+
+func funcScan[K, V any](l *link, rot uint64, do func(K, *V) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
+	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
+		if tmap&bit != 0 {
+			kv := (*funckv[K, V])(item.ptr)
+			if !do(kv.k, &kv.v) {
+				return false
+			}
+		} else if !funcScan(item, bits.RotateLeft64(rot, -4), do) {
+			return false
+		}
+		pmap &^= bit
+		idx++
+	}
+	return true
+}
+
+// Clear removes all values from m, retaining the seed and key functions of m. If m was
+// initialized with the Recycle option, the link arrays and key-values of m are retained for
+// reuse when values are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m FuncMap[K, V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*funckv[K, V])(p) = funckv[K, V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m FuncMap[K, V]) Retain(keep func(K, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*funckv[K, V])(item.ptr)
+		return keep(kv.k, &kv.v)
+	})
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed, key functions, and options of m: match, containing the values for which the pred callback
+// returns true, and rest, containing all other values. Keys are not rehashed, and sub-tries are
+// moved without copying when pred returns the same result for all of their values. The pred
+// callback must not modify m.
+func (m FuncMap[K, V]) Drain(pred func(K, *V) bool) (match, rest FuncMap[K, V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		kv := (*funckv[K, V])(item.ptr)
+		return pred(kv.k, &kv.v)
+	})
+	return FuncMap[K, V]{mr}, FuncMap[K, V]{rr}
+}
+
+// KeySet returns a new set containing the keys of m, with the key functions of m. The new set
+// has the same seed and layout as m, so keys are not rehashed or compared.
+func (m FuncMap[K, V]) KeySet() FuncSet[K] {
+	return FuncSet[K]{m.cloneRoot(func(dst, src *link) {
+		dst.ptr = unsafe.Pointer(&funckv[K, struct{}]{k: (*funckv[K, V])(src.ptr).k})
+	})}
+}
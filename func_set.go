@@ -0,0 +1,140 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"hash/maphash"
+	"unsafe"
+)
+
+// FuncSet is a set of keys which are hashed and compared using the functions given during
+// initialization, so keys of any type may be used without implementing Key[K]. The functions
+// are stored within the root of the set, alongside its seed. Methods on a set value will panic
+// if the set is not initialized. A set value is safe to copy.
+type FuncSet[K any] struct {
+	*root
+}
+
+// NewSetFunc returns an initialized set which hashes and compares keys with the hash and equal
+// functions. The hash function must hash the key 1 or more times, as in Key[K].Hash, and must
+// return equal hashes for keys which are equal according to the equal function. The set value
+// is safe to copy.
+func NewSetFunc[K any](hash func(seed maphash.Seed, key K, iter uint) uint64, equal func(a, b K) bool, opts ...Option) FuncSet[K] {
+	return FuncSet[K]{newFuncRoot(hash, equal, opts...)}
+}
+
+// Nil returns true if s is not initialized.
+func (s FuncSet[K]) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s FuncSet[K]) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s FuncSet[K]) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if key is in s. If s is not initialized, Has returns false.
+func (s FuncSet[K]) Has(key K) bool {
+	return s.root != nil && findFunc[K, struct{}](s.root, key) != nil
+}
+
+// Add adds key to s.
+func (s FuncSet[K]) Add(key K) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s FuncSet[K]) Insert(key K) bool {
+	_, existed := insertFunc[K, struct{}](s.root, key)
+	return !existed
+}
+
+// Del deletes key from s.
+func (s FuncSet[K]) Del(key K) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s FuncSet[K]) Remove(key K) bool {
+	_, existed := removeFunc[K, struct{}](s.root, key)
+	return existed
+}
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s FuncSet[K]) All(do func(K) bool) {
+	funcScan(&s.link, s.order(), func(k K, _ *struct{}) bool { return do(k) })
+}
+
+// Clear removes all keys from s, retaining the seed and key functions of s. If s was
+// initialized with the Recycle option, the link arrays and key-values of s are retained
+// for reuse when keys are added.
+func (s FuncSet[K]) Clear() {
+	s.clear(func(p unsafe.Pointer) { *(*funckv[K, struct{}])(p) = funckv[K, struct{}]{} })
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s FuncSet[K]) Retain(keep func(K) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep((*funckv[K, struct{}])(item.ptr).k)
+	})
+}
+
+// Drain moves all keys out of s, leaving s and every copy of s empty, into two new sets with the
+// seed, key functions, and options of s: match, containing the keys for which the pred callback
+// returns true, and rest, containing all other keys. Keys are not rehashed, and sub-tries are
+// moved without copying when pred returns the same result for all of their keys. The pred callback
+// must not modify s.
+func (s FuncSet[K]) Drain(pred func(K) bool) (match, rest FuncSet[K]) {
+	mr, rr := s.splitRoot(func(item *link) bool {
+		return pred((*funckv[K, struct{}])(item.ptr).k)
+	})
+	return FuncSet[K]{mr}, FuncSet[K]{rr}
+}
+
+// NewSetFuncFrom returns an initialized set containing the keys in src, which hashes and compares
+// keys with the hash and equal functions as in NewSetFunc. Keys are allocated in blocks of up to
+// 64, so each block is retained while any of its keys remain in the set. The set value is safe
+// to copy.
+func NewSetFuncFrom[K any](src []K, hash func(seed maphash.Seed, key K, iter uint) uint64, equal func(a, b K) bool, opts ...Option) FuncSet[K] {
+	s := NewSetFunc(hash, equal, opts...)
+	reserveItems[funckv[K, struct{}]](s.root, len(src))
+	for _, k := range src {
+		s.Add(k)
+	}
+	s.dropReserved()
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s FuncSet[K]) ToSlice() []K {
+	dst := make([]K, 0, s.len)
+	s.All(func(k K) bool {
+		dst = append(dst, k)
+		return true
+	})
+	return dst
+}
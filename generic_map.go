@@ -25,6 +25,8 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
+	"sort"
 	"unsafe"
 )
 
@@ -60,8 +62,8 @@ type kv[K Key[K], V any] struct {
 }
 
 // NewMap returns an initialized map. The map value is safe to copy.
-func NewMap[K Key[K], V any]() Map[K, V] {
-	return Map[K, V]{newRoot()}
+func NewMap[K Key[K], V any](opts ...Option) Map[K, V] {
+	return Map[K, V]{newRoot(opts...)}
 }
 
 // Nil returns true if m is not initialized.
@@ -122,7 +124,14 @@ func (m Map[K, V]) Ptr(key K) *V {
 
 // Set adds or updates the value for key.
 func (m Map[K, V]) Set(key K, value V) {
-	hd, l, d := key.Hash(m.seed, 0), &m.link, uint8(0)
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m Map[K, V]) Swap(key K, value V) (old V, existed bool) {
+	hash := key.Hash(m.seed, 0)
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -142,11 +151,11 @@ func (m Map[K, V]) Set(key K, value V) {
 		ckv := (*kv[K, V])(item.ptr)
 		ckey := ckv.k
 		if key.Equal(ckey) { // update existing
-			ckv.v = value
-			return
+			old, ckv.v = ckv.v, value
+			return old, true
 		}
 		// rehash conflicting key
-		chd := ckey.Hash(m.seed, uint(d%(64/4))) >> (4 * (d % (64 / 4)))
+		chd := ckey.Hash(m.seed, uint(d>>4)) >> (4 * (d & 0xF))
 		// replace with new branch until non-colliding
 		l.tmap &^= bit
 		m.dep -= uint64(d) // conflicting key depth
@@ -162,19 +171,19 @@ func (m Map[K, V]) Set(key K, value V) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &kv[K, V]{value, key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, kv[K, V]{value, key})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -185,17 +194,17 @@ func (m Map[K, V]) Set(key K, value V) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&kv[K, V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, kv[K, V]{k: key, v: value})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&kv[K, V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, kv[K, V]{k: key, v: value})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -204,14 +213,16 @@ func (m Map[K, V]) Set(key K, value V) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
+	return // item added
 }
 
 // Mod modifies the value for key using the mod callback. The mod callback receives
 // a pointer to the existing or new value for key, and true if the key existed.
 func (m Map[K, V]) Mod(key K, mod func(*V, bool)) {
-	hd, l, d := key.Hash(m.seed, 0), &m.link, uint8(0)
+	hash := key.Hash(m.seed, 0)
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -235,7 +246,7 @@ func (m Map[K, V]) Mod(key K, mod func(*V, bool)) {
 			return
 		}
 		// rehash conflicting key
-		chd := key.Hash(m.seed, uint(d%(64/4))) >> (4 * (d % (64 / 4)))
+		chd := ckey.Hash(m.seed, uint(d>>4)) >> (4 * (d & 0xF))
 		// replace with new branch until non-colliding
 		l.tmap &^= bit
 		m.dep -= uint64(d) // conflicting key depth
@@ -251,24 +262,24 @@ func (m Map[K, V]) Mod(key K, mod func(*V, bool)) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &kv[K, V]{k: key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, kv[K, V]{k: key})
 				mod(&kv.v, false)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
-	kv := &kv[K, V]{k: key}
+	kv := newItem(m.root, kv[K, V]{k: key})
 	mod(&kv.v, false)
 	count := uint8(bits.OnesCount32(l.pmap))
 	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
@@ -281,7 +292,7 @@ func (m Map[K, V]) Mod(key K, mod func(*V, bool)) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -296,14 +307,20 @@ func (m Map[K, V]) Mod(key K, mod func(*V, bool)) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
 }
 
 // Del deletes the value for key.
 func (m Map[K, V]) Del(key K) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m Map[K, V]) Delete(key K) (old V, existed bool) {
 	path := m.path[:0]
-	hd, l, d := key.Hash(m.seed, 0), &m.link, uint8(0)
+	hash := key.Hash(m.seed, 0)
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -324,9 +341,10 @@ func (m Map[K, V]) Del(key K) {
 		if !key.Equal((*kv[K, V])(item.ptr).k) { // key missing
 			return
 		}
+		old, existed = (*kv[K, V])(item.ptr).v, true
 		l.pmap &^= bit
 		l.tmap &^= bit
-		m.len--
+		m.removed(hash)
 		m.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -344,7 +362,7 @@ func (m Map[K, V]) Del(key K) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = m.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -371,30 +389,437 @@ func (m Map[K, V]) Del(key K) {
 		}
 		return // item removed
 	}
+	return // item missing
 }
 
 // All ranges over values in m, applying the do callback to each value until
 // the callback returns false or all values have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (m Map[K, V]) All(do func(K, *V) bool) {
-	mapScan(&m.link, do)
+	mapScan(&m.link, m.order(), do)
 }
 
-func mapScan[K Key[K], V any](l *link, do func(K, *V) bool) bool {
+func mapScan[K Key[K], V any](l *link, rot uint64, do func(K, *V) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*kv[K, V])(item.ptr)
 			if !do(kv.k, &kv.v) {
 				return false
 			}
-		} else if !mapScan(item, do) {
+		} else if !mapScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// SortedAllFunc ranges over values in m in ascending order of keys, applying the do callback
+// to each value until the callback returns false or all values have been visited. The cmp
+// function must return a negative number if a < b, a positive number if a > b, or zero if
+// a == b. Keys for which cmp returns zero are visited in an unspecified but fixed order.
+// Keys are not ordered within a map, so the values of each sub-trie with up to 256 values are
+// ordered by a cursor which buffers its next 32 keys, and cursors are merged through a heap.
+// Memory is used for the cursors rather than for each value in m, and keys are not sorted before
+// the first value is visited. The do callback must not modify m.
+func (m Map[K, V]) SortedAllFunc(cmp func(a, b K) int, do func(K, *V) bool) {
+	sortedScan(&m.link, m.len, func(a, b *link) int {
+		return cmp((*kv[K, V])(a.ptr).k, (*kv[K, V])(b.ptr).k)
+	}, func(item *link) bool {
+		kv := (*kv[K, V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// SortedKeysFunc returns the keys in m in ascending order, as determined by the cmp function.
+// See SortedAllFunc.
+func (m Map[K, V]) SortedKeysFunc(cmp func(a, b K) int) []K {
+	keys := make([]K, 0, m.len)
+	mapScan(&m.link, 0, func(k K, _ *V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return cmp(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// MapPart is a view of the values within a contiguous range of hashes in a map.
+// A part is invalidated when the map is modified.
+type MapPart[K Key[K], V any] struct {
+	part
+}
+
+// Partition splits m into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in m. Parts agree only between maps with the seed of m, such as the copies of m
+// and the maps returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when m is modified.
+func (m Map[K, V]) Partition(n uint) []MapPart[K, V] {
+	return partition(m.root, n, m.itemHash, func(p part) MapPart[K, V] { return MapPart[K, V]{p} })
+}
+
+// PartitionFunc splits m into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in m. Unlike Partition, the part of a key depends only on
+// hash, so maps with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of m. Parts are invalidated
+// when m is modified.
+func (m Map[K, V]) PartitionFunc(n uint, hash func(K) uint64) []MapPart[K, V] {
+	key := func(item *link) uint64 { return hash((*kv[K, V])(item.ptr).k) }
+	return partitionFunc(m.root, n, key, func(p part) MapPart[K, V] { return MapPart[K, V]{p} })
+}
+
+// All ranges over values in p, applying the do callback to each value until
+// the callback returns false or all values have been visited.
+func (p MapPart[K, V]) All(do func(K, *V) bool) {
+	p.scan(func(item *link) bool {
+		kv := (*kv[K, V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m Map[K, V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*kv[K, V])(p) = kv[K, V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m Map[K, V]) Retain(keep func(K, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*kv[K, V])(item.ptr)
+		return keep(kv.k, &kv.v)
+	})
+}
+
+// MapValues returns a new map with the keys of m, where the value for each key is the
+// result of the fn callback. The new map has the same seed and layout as m, so keys are not
+// rehashed or compared.
+func MapValues[K Key[K], V, W any](m Map[K, V], fn func(K, *V) W) Map[K, W] {
+	return Map[K, W]{m.cloneRoot(func(dst, src *link) {
+		ckv := (*kv[K, V])(src.ptr)
+		dst.ptr = unsafe.Pointer(&kv[K, W]{fn(ckv.k, &ckv.v), ckv.k})
+	})}
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed and options of m: match, containing the values for which the pred callback returns true,
+// and rest, containing all other values. Keys are not rehashed, and sub-tries are moved without
+// copying when pred returns the same result for all of their values. The pred callback must not
+// modify m.
+func (m Map[K, V]) Drain(pred func(K, *V) bool) (match, rest Map[K, V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		kv := (*kv[K, V])(item.ptr)
+		return pred(kv.k, &kv.v)
+	})
+	return Map[K, V]{mr}, Map[K, V]{rr}
+}
+
+// NewMapFrom returns an initialized map containing the key-values in src. Key-values
+// are allocated in blocks of up to 64, so each block is retained while any of its key-values
+// remain in the map. The map value is safe to copy.
+func NewMapFrom[K interface {
+	Key[K]
+	comparable
+}, V any](src map[K]V, opts ...Option) Map[K, V] {
+	m := NewMap[K, V](opts...)
+	reserveItems[kv[K, V]](m.root, len(src))
+	for k, v := range src {
+		m.Set(k, v)
+	}
+	m.dropReserved()
+	return m
+}
+
+// ToMap returns a builtin map containing the key-values in m.
+func ToMap[K interface {
+	Key[K]
+	comparable
+}, V any](m Map[K, V]) map[K]V {
+	dst := make(map[K]V, m.len)
+	mapScan(&m.link, 0, func(k K, v *V) bool {
+		dst[k] = *v
+		return true
+	})
+	return dst
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m Map[K, V]) KeySet() Set[K] {
+	return Set[K]{m.cloneRoot(func(dst, src *link) {
+		dst.ptr = unsafe.Pointer(&kv[K, struct{}]{k: (*kv[K, V])(src.ptr).k})
+	})}
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	m.Mod(key, func(v *V, ok bool) {
+		if !ok {
+			*v = value
+		}
+		actual, loaded = *v, ok
+	})
+	return actual, loaded
+}
+
+// CompareAndSwapFunc swaps the old and new values for key if key exists and its value
+// is equal to old, according to the eq callback. It returns true if the value was swapped.
+func (m Map[K, V]) CompareAndSwapFunc(key K, old, new V, eq func(V, V) bool) (swapped bool) {
+	if v := m.Ptr(key); v != nil && eq(*v, old) {
+		*v = new
+		return true
+	}
+	return false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value and true if key
+// existed. It is equivalent to Delete.
+func (m Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// PopAny removes an arbitrary key-value from m, returning the key, value, and true if m
+// was not empty.
+func (m Map[K, V]) PopAny() (key K, value V, ok bool) {
+	item, ok := m.popAny(m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*kv[K, V])(item.ptr)
+	return kv.k, kv.v, true
+}
+
+// MapEntry is a handle to the value for a key within a map, used to insert, update, or remove
+// the value without rehashing the key or repeating the traversal from the root. An entry is
+// invalidated when the map is modified other than through the entry.
+type MapEntry[K Key[K], V any] struct {
+	entry
+	kv  *kv[K, V]
+	key K
+}
+
+// Entry returns an entry for key in m.
+func (m Map[K, V]) Entry(key K) (e MapEntry[K, V]) {
+	e.r, e.l, e.key = m.root, &m.link, key
+	e.h = key.Hash(m.seed, 0)
+	e.hd = e.h
+	e.radix = uint8(e.hd & 0xF)
+	for item := e.item(); item != nil; item = e.item() {
+		if e.l.tmap&(1<<e.radix) != 0 { // key-value
+			if kv := (*kv[K, V])(item.ptr); key.Equal(kv.k) {
+				e.kv = kv
+			}
+			return e
+		}
+		if e.descend(item) { // rehash
+			e.hd = key.Hash(m.seed, uint(e.d>>4))
+		}
+		e.radix = uint8(e.hd & 0xF)
+	}
+	return e
+}
+
+// Exists returns true if the key of e exists in the map.
+func (e *MapEntry[K, V]) Exists() bool { return e.kv != nil }
+
+// Value returns a pointer to the value for the key of e, or nil if the key does not exist.
+func (e *MapEntry[K, V]) Value() *V {
+	if e.kv == nil {
+		return nil
+	}
+	return &e.kv.v
+}
+
+// Insert adds or updates the value for the key of e.
+func (e *MapEntry[K, V]) Insert(value V) {
+	if e.kv != nil { // update existing
+		e.kv.v = value
+		return
+	}
+	if e.stale { // traverse the modified trie
+		*e = Map[K, V]{e.r}.Entry(e.key)
+	}
+	nkv := newItem(e.r, kv[K, V]{value, e.key})
+	item := e.item()
+	if item == nil {
+		e.r.insertItem(e.l, e.d, e.radix, e.h, link{ptr: unsafe.Pointer(nkv)})
+	} else { // rehash conflicting key
+		ckey := (*kv[K, V])(item.ptr).k
+		iter := uint(e.d >> 4)
+		chd := ckey.Hash(e.r.seed, iter) >> (4 * (e.d & 0xF))
+		e.r.branchItems(e.l, item, e.d, e.radix, e.h, e.hd, chd, func() (uint64, uint64) {
+			iter++
+			return e.key.Hash(e.r.seed, iter), ckey.Hash(e.r.seed, iter)
+		}, link{ptr: unsafe.Pointer(nkv)})
+	}
+	e.kv, e.stale = nkv, true
+}
+
+// Remove deletes the value for the key of e, if the key exists.
+func (e *MapEntry[K, V]) Remove() {
+	if e.stale { // traverse the modified trie
+		*e = Map[K, V]{e.r}.Entry(e.key)
+	}
+	if e.kv == nil {
+		return
+	}
+	if !e.remove() {
+		Map[K, V]{e.r}.Del(e.key)
+	}
+	e.kv = nil
+}
+
+// GetMany looks up the values for keys, storing the value for each key in values at the index
+// of the key, and true in found if found is not nil. Missing keys are assigned the zero value.
+// Keys are hashed and sorted by hash path before walking m once, so links are traversed once for
+// each common prefix. It returns the number of keys found, and panics if values or a non-nil
+// found are shorter than keys.
+func (m Map[K, V]) GetMany(keys []K, values []V, found []bool) (n int) {
+	checkMany("GetMany", len(keys), len(values), found)
+	values = values[:len(keys)]
+	if found != nil {
+		found = found[:len(keys)]
+	}
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		return keys[i].Hash(m.seed, 0)
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		var v *V
+		if item, _, ok := b.next(bk.path); !ok {
+			v = m.Ptr(key)
+		} else if item != nil {
+			if ckv := (*kv[K, V])(item.ptr); key.Equal(ckv.k) {
+				v = &ckv.v
+			}
+		}
+		if v != nil {
+			values[bk.i] = *v
+			n++
+		} else {
+			var zero V
+			values[bk.i] = zero
+		}
+		if found != nil {
+			found[bk.i] = v != nil
+		}
+	}
+	return n
+}
+
+// SetMany adds or updates the value for each key to the value in values at the index of the key,
+// as if Set were called for each key in order. Keys are hashed and sorted by hash path before
+// walking m once. It panics if values is shorter than keys.
+func (m Map[K, V]) SetMany(keys []K, values []V) {
+	checkMany("SetMany", len(keys), len(values), nil)
+	values = values[:len(keys)]
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		return keys[i].Hash(m.seed, 0)
+	})
+	for _, bk := range b.keys {
+		key, value := keys[bk.i], values[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			m.Set(key, value)
+			b.reset()
+			continue
+		}
+		if item == nil {
+			b.insert(d, link{ptr: unsafe.Pointer(newItem(m.root, kv[K, V]{value, key}))})
+			continue
+		}
+		if ckv := (*kv[K, V])(item.ptr); key.Equal(ckv.k) { // update existing
+			ckv.v = value
+			continue
+		}
+		// rehash conflicting key
+		ckey, iter := (*kv[K, V])(item.ptr).k, uint(0)
+		b.branch(item, d, bk.hash>>(4*d), ckey.Hash(m.seed, 0)>>(4*d), func() (uint64, uint64) {
+			iter++
+			return key.Hash(m.seed, iter), ckey.Hash(m.seed, iter)
+		}, link{ptr: unsafe.Pointer(newItem(m.root, kv[K, V]{value, key}))})
+	}
+}
+
+// DelMany deletes the values for keys. Keys are hashed and sorted by hash path before walking
+// m once. It returns the number of values deleted.
+func (m Map[K, V]) DelMany(keys []K) (n int) {
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		return keys[i].Hash(m.seed, 0)
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			if _, ok := m.Delete(key); ok {
+				n++
+			}
+			b.reset()
+		} else if item != nil && key.Equal((*kv[K, V])(item.ptr).k) {
+			b.remove(d)
+			n++
+		}
+	}
+	return n
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (m Map[K, V]) itemHash(item *link) uint64 {
+	return (*kv[K, V])(item.ptr).k.Hash(m.seed, 0)
+}
+
+// RandomKey returns a uniformly random key in m, and false if m is empty. The keys in m are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// m is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (m Map[K, V]) RandomKey(rng *rand.Rand) (key K, ok bool) {
+	item := m.randomItem(rng, m.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*kv[K, V])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in m, chosen uniformly at random. If n is at most half
+// the length of m, keys are selected as in RandomKey. Otherwise m is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (m Map[K, V]) Sample(n int, rng *rand.Rand) []K {
+	items := m.sample(n, rng, m.itemHash)
+	keys := make([]K, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*kv[K, V])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key-value from m, returning the key, value, and true
+// if m was not empty. The key-value is selected as in RandomKey, and unlinked through the path
+// traversed during selection. If rng is nil, the default source of math/rand is used.
+func (m Map[K, V]) PopRandom(rng *rand.Rand) (key K, value V, ok bool) {
+	item, ok := m.popRandom(rng, m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	ckv := (*kv[K, V])(item.ptr)
+	return ckv.k, ckv.v, true
+}
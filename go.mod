@@ -1,3 +1,3 @@
 module github.com/wdamron/amt
 
-go 1.18
+go 1.19
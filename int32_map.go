@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"math/bits"
+	"sort"
+	"unsafe"
+)
+
+// Value32 is a constraint for the value types of Int32Map[V], which are at most 4 bytes wide.
+type Value32 interface {
+	~int8 | ~int16 | ~int32 | ~uint8 | ~uint16 | ~uint32 | ~float32 | ~bool
+}
+
+// Int32Map maps 32-bit integers to values of at most 4 bytes. Each key is stored inline within
+// the pmap field of its leaf link, and each value within the tmap field, so values are not
+// allocated. Values are copied in and out of the map, as there is no stable pointer to each
+// value. Methods on a map value will panic if the map is not initialized. A map value is safe
+// to copy.
+type Int32Map[V Value32] struct {
+	*root
+}
+
+// NewInt32Map returns an initialized map. The map value is safe to copy.
+func NewInt32Map[V Value32](opts ...Option) Int32Map[V] {
+	return Int32Map[V]{newRoot(opts...)}
+}
+
+func packValue32[V Value32](v V) (b uint32) {
+	*(*V)(unsafe.Pointer(&b)) = v
+	return b
+}
+
+func unpackValue32[V Value32](b uint32) V {
+	return *(*V)(unsafe.Pointer(&b))
+}
+
+// Nil returns true if m is not initialized.
+func (m Int32Map[V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m Int32Map[V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m Int32Map[V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m Int32Map[V]) Get(key int32) (value V, ok bool) {
+	if item := findInteger(m.root, key); item != nil {
+		return unpackValue32[V](item.tmap), true
+	}
+	return value, false
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m Int32Map[V]) Val(key int32) (value V) {
+	if m.root != nil {
+		value, _ = m.Get(key)
+	}
+	return
+}
+
+// Set adds or updates the value for key.
+func (m Int32Map[V]) Set(key int32, value V) {
+	item, _ := insertInteger(m.root, key, noItem)
+	item.tmap = packValue32(value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m Int32Map[V]) Swap(key int32, value V) (old V, existed bool) {
+	item, existed := insertInteger(m.root, key, noItem)
+	if existed {
+		old = unpackValue32[V](item.tmap)
+	}
+	item.tmap = packValue32(value)
+	return old, existed
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to a copy of the existing or new value for key, and true if the key existed.
+// The modified value is stored after the callback returns.
+func (m Int32Map[V]) Mod(key int32, mod func(*V, bool)) {
+	item, existed := insertInteger(m.root, key, noItem)
+	var value V
+	if existed {
+		value = unpackValue32[V](item.tmap)
+	}
+	mod(&value, existed)
+	item.tmap = packValue32(value)
+}
+
+// Del deletes the value for key.
+func (m Int32Map[V]) Del(key int32) {
+	removeInteger(m.root, key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m Int32Map[V]) Delete(key int32) (old V, existed bool) {
+	if item, ok := removeInteger(m.root, key); ok {
+		return unpackValue32[V](item.tmap), true
+	}
+	return old, false
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m Int32Map[V]) All(do func(int32, V) bool) {
+	int32Scan(&m.link, m.order(), do)
+}
+
+func int32Scan[V Value32](l *link, rot uint64, do func(int32, V) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
+	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
+		if tmap&bit != 0 {
+			if !do(int32(item.pmap), unpackValue32[V](item.tmap)) {
+				return false
+			}
+		} else if !int32Scan(item, bits.RotateLeft64(rot, -4), do) {
+			return false
+		}
+		pmap &^= bit
+		idx++
+	}
+	return true
+}
+
+// SortedKeys returns the keys in m in ascending order.
+func (m Int32Map[V]) SortedKeys() []int32 {
+	keys := make([]int32, 0, m.len)
+	int32Scan(&m.link, 0, func(k int32, _ V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays of m are retained for reuse when values are added.
+func (m Int32Map[V]) Clear() {
+	m.clear(nil) // keys and values are stored inline without key-values
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m.
+func (m Int32Map[V]) Retain(keep func(int32, V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		return keep(int32(item.pmap), unpackValue32[V](item.tmap))
+	})
+}
@@ -25,22 +25,11 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
+	"sort"
 	"unsafe"
 )
 
-// Int may be used as the key type of a generic Map[Int, V].
-type Int int
-
-func (i Int) Hash(seed maphash.Seed, iter uint) uint64 {
-	b := intbytes(IntKey(i))
-	var hw maphash.Hash
-	hw.SetSeed(seed)
-	for i := uint(0); i <= iter; i++ {
-		hw.Write(b[:])
-	}
-	return hw.Sum64()
-}
-
 // IntKey is an alias for int64, the key type for IntMap[V].
 type IntKey = int64
 
@@ -59,8 +48,8 @@ func intbytes(k IntKey) [8]byte {
 }
 
 // NewIntMap returns an initialized map. The map value is safe to copy.
-func NewIntMap[V any]() IntMap[V] {
-	return IntMap[V]{newRoot()}
+func NewIntMap[V any](opts ...Option) IntMap[V] {
+	return IntMap[V]{newRoot(opts...)}
 }
 
 // Nil returns true if m is not initialized.
@@ -126,11 +115,18 @@ func (m IntMap[V]) Ptr(key IntKey) *V {
 
 // Set adds or updates the value for key.
 func (m IntMap[V]) Set(key IntKey, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m IntMap[V]) Swap(key IntKey, value V) (old V, existed bool) {
 	kb := intbytes(key)
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -151,8 +147,8 @@ func (m IntMap[V]) Set(key IntKey, value V) {
 		cval := (*intkv[V])(item.ptr)
 		ckey := IntKey(item.pmap) | (IntKey(item.tmap) << 32)
 		if ckey == key { // update existing
-			cval.v = value
-			return
+			old, cval.v = cval.v, value
+			return old, true
 		}
 		// rehash conflicting key
 		ckb := intbytes(ckey)
@@ -179,8 +175,8 @@ func (m IntMap[V]) Set(key IntKey, value V) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				val := &intkv[V]{value}
+				item.ptr = m.newLinkArray(2)
+				val := newItem(m.root, intkv[V]{value})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0] = link{ptr: unsafe.Pointer(val), pmap: uint32(key), tmap: uint32(key >> 32)}
 					pair[1] = link{ptr: unsafe.Pointer(cval), pmap: uint32(ckey), tmap: uint32(ckey >> 32)}
@@ -188,12 +184,13 @@ func (m IntMap[V]) Set(key IntKey, value V) {
 					pair[0] = link{ptr: unsafe.Pointer(cval), pmap: uint32(ckey), tmap: uint32(ckey >> 32)}
 					pair[1] = link{ptr: unsafe.Pointer(val), pmap: uint32(key), tmap: uint32(key >> 32)}
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.tmap = 0 // clear the inline conflicting key
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -204,19 +201,19 @@ func (m IntMap[V]) Set(key IntKey, value V) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr:  unsafe.Pointer(&intkv[V]{value}),
+			ptr:  unsafe.Pointer(newItem(m.root, intkv[V]{value})),
 			pmap: uint32(key),
 			tmap: uint32(key >> 32),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr:  unsafe.Pointer(&intkv[V]{value}),
+			ptr:  unsafe.Pointer(newItem(m.root, intkv[V]{value})),
 			pmap: uint32(key),
 			tmap: uint32(key >> 32),
 		}
@@ -227,8 +224,9 @@ func (m IntMap[V]) Set(key IntKey, value V) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
+	return // item added
 }
 
 // Mod modifies the value for key using the mod callback. The mod callback receives
@@ -238,7 +236,8 @@ func (m IntMap[V]) Mod(key IntKey, mod func(*V, bool)) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -287,8 +286,8 @@ func (m IntMap[V]) Mod(key IntKey, mod func(*V, bool)) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				val := &intkv[V]{}
+				item.ptr = m.newLinkArray(2)
+				val := newItem(m.root, intkv[V]{})
 				mod(&val.v, false)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0] = link{ptr: unsafe.Pointer(val), pmap: uint32(key), tmap: uint32(key >> 32)}
@@ -297,16 +296,17 @@ func (m IntMap[V]) Mod(key IntKey, mod func(*V, bool)) {
 					pair[0] = link{ptr: unsafe.Pointer(cval), pmap: uint32(ckey), tmap: uint32(ckey >> 32)}
 					pair[1] = link{ptr: unsafe.Pointer(val), pmap: uint32(key), tmap: uint32(key >> 32)}
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.tmap = 0 // clear the inline conflicting key
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
-	val := &intkv[V]{}
+	val := newItem(m.root, intkv[V]{})
 	mod(&val.v, false)
 	count := uint8(bits.OnesCount32(l.pmap))
 	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
@@ -321,7 +321,7 @@ func (m IntMap[V]) Mod(key IntKey, mod func(*V, bool)) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -338,18 +338,24 @@ func (m IntMap[V]) Mod(key IntKey, mod func(*V, bool)) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
 }
 
 // Del deletes the value for key.
 func (m IntMap[V]) Del(key IntKey) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m IntMap[V]) Delete(key IntKey) (old V, existed bool) {
 	path := m.path[:0]
 	kb := intbytes(key)
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -371,9 +377,10 @@ func (m IntMap[V]) Del(key IntKey) {
 		if k := IntKey(item.pmap) | (IntKey(item.tmap) << 32); k != key { // key missing
 			return
 		}
+		old, existed = (*intkv[V])(item.ptr).v, true
 		l.pmap &^= bit
 		l.tmap &^= bit
-		m.len--
+		m.removed(hash)
 		m.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -391,7 +398,7 @@ func (m IntMap[V]) Del(key IntKey) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = m.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -418,30 +425,468 @@ func (m IntMap[V]) Del(key IntKey) {
 		}
 		return // item removed
 	}
+	return // item missing
 }
 
 // All ranges over values in m, applying the do callback to each value until
 // the callback returns false or all values have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (m IntMap[V]) All(do func(IntKey, *V) bool) {
-	intScan(&m.link, do)
+	intScan(&m.link, m.order(), do)
 }
 
-func intScan[V any](l *link, do func(IntKey, *V) bool) bool {
+func intScan[V any](l *link, rot uint64, do func(IntKey, *V) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			val := (*intkv[V])(item.ptr)
 			if k := IntKey(item.pmap) | (IntKey(item.tmap) << 32); !do(k, &val.v) {
 				return false
 			}
-		} else if !intScan(item, do) {
+		} else if !intScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// SortedAll ranges over values in m in ascending order of keys, applying the do callback
+// to each value until the callback returns false or all values have been visited.
+// Keys are not ordered within a map, so the values of each sub-trie with up to 256 values are
+// ordered by a cursor which buffers its next 32 keys, and cursors are merged through a heap.
+// Memory is used for the cursors rather than for each value in m, and keys are not sorted before
+// the first value is visited. The do callback must not modify m.
+func (m IntMap[V]) SortedAll(do func(IntKey, *V) bool) {
+	sortedScan(&m.link, m.len, func(a, b *link) int {
+		x, y := IntKey(a.pmap)|(IntKey(a.tmap)<<32), IntKey(b.pmap)|(IntKey(b.tmap)<<32)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}, func(item *link) bool {
+		return do(IntKey(item.pmap)|(IntKey(item.tmap)<<32), &(*intkv[V])(item.ptr).v)
+	})
+}
+
+// SortedKeys returns the keys in m in ascending order.
+func (m IntMap[V]) SortedKeys() []IntKey {
+	keys := make([]IntKey, 0, m.len)
+	intScan(&m.link, 0, func(k IntKey, _ *V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// IntMapPart is a view of the values within a contiguous range of hashes in a map.
+// A part is invalidated when the map is modified.
+type IntMapPart[V any] struct {
+	part
+}
+
+// Partition splits m into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in m. Parts agree only between maps with the seed of m, such as the copies of m
+// and the maps returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when m is modified.
+func (m IntMap[V]) Partition(n uint) []IntMapPart[V] {
+	return partition(m.root, n, m.itemHash, func(p part) IntMapPart[V] { return IntMapPart[V]{p} })
+}
+
+// PartitionFunc splits m into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in m. Unlike Partition, the part of a key depends only on
+// hash, so maps with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of m. Parts are invalidated
+// when m is modified.
+func (m IntMap[V]) PartitionFunc(n uint, hash func(IntKey) uint64) []IntMapPart[V] {
+	key := func(item *link) uint64 { return hash(IntKey(item.pmap) | IntKey(item.tmap)<<32) }
+	return partitionFunc(m.root, n, key, func(p part) IntMapPart[V] { return IntMapPart[V]{p} })
+}
+
+// All ranges over values in p, applying the do callback to each value until
+// the callback returns false or all values have been visited.
+func (p IntMapPart[V]) All(do func(IntKey, *V) bool) {
+	p.scan(func(item *link) bool {
+		k := IntKey(item.pmap) | (IntKey(item.tmap) << 32)
+		return do(k, &(*intkv[V])(item.ptr).v)
+	})
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m IntMap[V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*intkv[V])(p) = intkv[V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m IntMap[V]) Retain(keep func(IntKey, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		k := IntKey(item.pmap) | (IntKey(item.tmap) << 32)
+		return keep(k, &(*intkv[V])(item.ptr).v)
+	})
+}
+
+// MapIntValues returns a new map with the keys of m, where the value for each key is the
+// result of the fn callback. The new map has the same seed and layout as m, so keys are not
+// rehashed or compared.
+func MapIntValues[V, W any](m IntMap[V], fn func(IntKey, *V) W) IntMap[W] {
+	return IntMap[W]{m.cloneRoot(func(dst, src *link) {
+		k := IntKey(src.pmap) | (IntKey(src.tmap) << 32)
+		*dst = link{
+			ptr:  unsafe.Pointer(&intkv[W]{fn(k, &(*intkv[V])(src.ptr).v)}),
+			pmap: src.pmap,
+			tmap: src.tmap,
+		}
+	})}
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed and options of m: match, containing the values for which the pred callback returns true,
+// and rest, containing all other values. Keys are not rehashed, and sub-tries are moved without
+// copying when pred returns the same result for all of their values. The pred callback must not
+// modify m.
+func (m IntMap[V]) Drain(pred func(IntKey, *V) bool) (match, rest IntMap[V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		k := IntKey(item.pmap) | (IntKey(item.tmap) << 32)
+		return pred(k, &(*intkv[V])(item.ptr).v)
+	})
+	return IntMap[V]{mr}, IntMap[V]{rr}
+}
+
+// NewIntMapFrom returns an initialized map containing the key-values in src. Key-values
+// are allocated in blocks of up to 64, so each block is retained while any of its key-values
+// remain in the map. The map value is safe to copy.
+func NewIntMapFrom[V any](src map[IntKey]V, opts ...Option) IntMap[V] {
+	m := NewIntMap[V](opts...)
+	reserveItems[intkv[V]](m.root, len(src))
+	for k, v := range src {
+		m.Set(k, v)
+	}
+	m.dropReserved()
+	return m
+}
+
+// ToMap returns a builtin map containing the key-values in m.
+func (m IntMap[V]) ToMap() map[IntKey]V {
+	dst := make(map[IntKey]V, m.len)
+	intScan(&m.link, 0, func(k IntKey, v *V) bool {
+		dst[k] = *v
+		return true
+	})
+	return dst
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m IntMap[V]) KeySet() IntSet {
+	return IntSet{m.cloneRoot(func(dst, src *link) {
+		dst.pmap, dst.tmap = src.pmap, src.tmap
+	})}
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m IntMap[V]) GetOrSet(key IntKey, value V) (actual V, loaded bool) {
+	m.Mod(key, func(v *V, ok bool) {
+		if !ok {
+			*v = value
+		}
+		actual, loaded = *v, ok
+	})
+	return actual, loaded
+}
+
+// CompareAndSwapFunc swaps the old and new values for key if key exists and its value
+// is equal to old, according to the eq callback. It returns true if the value was swapped.
+func (m IntMap[V]) CompareAndSwapFunc(key IntKey, old, new V, eq func(V, V) bool) (swapped bool) {
+	if v := m.Ptr(key); v != nil && eq(*v, old) {
+		*v = new
+		return true
+	}
+	return false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value and true if key
+// existed. It is equivalent to Delete.
+func (m IntMap[V]) LoadAndDelete(key IntKey) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// PopAny removes an arbitrary key-value from m, returning the key, value, and true if m
+// was not empty.
+func (m IntMap[V]) PopAny() (key IntKey, value V, ok bool) {
+	item, ok := m.popAny(m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	return IntKey(item.pmap) | (IntKey(item.tmap) << 32), (*intkv[V])(item.ptr).v, true
+}
+
+// IntMapEntry is a handle to the value for a key within a map, used to insert, update, or remove
+// the value without rehashing the key or repeating the traversal from the root. An entry is
+// invalidated when the map is modified other than through the entry.
+type IntMapEntry[V any] struct {
+	entry
+	kv  *intkv[V]
+	key IntKey
+	hw  maphash.Hash
+}
+
+// Entry returns an entry for key in m.
+func (m IntMap[V]) Entry(key IntKey) (e IntMapEntry[V]) {
+	e.r, e.l, e.key = m.root, &m.link, key
+	kb := intbytes(key)
+	e.hw.SetSeed(m.seed)
+	e.hw.Write(kb[:])
+	e.h = e.hw.Sum64()
+	e.hd = e.h
+	e.radix = uint8(e.hd & 0xF)
+	for item := e.item(); item != nil; item = e.item() {
+		if e.l.tmap&(1<<e.radix) != 0 { // key-value
+			if IntKey(item.pmap)|(IntKey(item.tmap)<<32) == key {
+				e.kv = (*intkv[V])(item.ptr)
+			}
+			return e
+		}
+		if e.descend(item) { // rehash
+			e.hw.Write(kb[:])
+			e.hd = e.hw.Sum64()
+		}
+		e.radix = uint8(e.hd & 0xF)
+	}
+	return e
+}
+
+// Exists returns true if the key of e exists in the map.
+func (e *IntMapEntry[V]) Exists() bool { return e.kv != nil }
+
+// Value returns a pointer to the value for the key of e, or nil if the key does not exist.
+func (e *IntMapEntry[V]) Value() *V {
+	if e.kv == nil {
+		return nil
+	}
+	return &e.kv.v
+}
+
+// Insert adds or updates the value for the key of e.
+func (e *IntMapEntry[V]) Insert(value V) {
+	if e.kv != nil { // update existing
+		e.kv.v = value
+		return
+	}
+	if e.stale { // traverse the modified trie
+		*e = IntMap[V]{e.r}.Entry(e.key)
+	}
+	kv := newItem(e.r, intkv[V]{value})
+	item := e.item()
+	if item == nil {
+		e.r.insertItem(e.l, e.d, e.radix, e.h, link{ptr: unsafe.Pointer(kv), pmap: uint32(e.key), tmap: uint32(e.key >> 32)})
+	} else { // rehash conflicting key
+		kb, ckb := intbytes(e.key), intbytes(IntKey(item.pmap)|(IntKey(item.tmap)<<32))
+		var chw maphash.Hash
+		chw.SetSeed(e.r.seed)
+		for cd := uint8(0); cd <= e.d; cd += (64 / 4) {
+			chw.Write(ckb[:])
+		}
+		chd := chw.Sum64() >> (4 * (e.d % (64 / 4)))
+		e.r.branchItems(e.l, item, e.d, e.radix, e.h, e.hd, chd, func() (uint64, uint64) {
+			e.hw.Write(kb[:])
+			chw.Write(ckb[:])
+			return e.hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(kv), pmap: uint32(e.key), tmap: uint32(e.key >> 32)})
+	}
+	e.kv, e.stale = kv, true
+}
+
+// Remove deletes the value for the key of e, if the key exists.
+func (e *IntMapEntry[V]) Remove() {
+	if e.stale { // traverse the modified trie
+		*e = IntMap[V]{e.r}.Entry(e.key)
+	}
+	if e.kv == nil {
+		return
+	}
+	if !e.remove() {
+		IntMap[V]{e.r}.Del(e.key)
+	}
+	e.kv = nil
+}
+
+// GetMany looks up the values for keys, storing the value for each key in values at the index
+// of the key, and true in found if found is not nil. Missing keys are assigned the zero value.
+// Keys are hashed and sorted by hash path before walking m once, so links are traversed once for
+// each common prefix. It returns the number of keys found, and panics if values or a non-nil
+// found are shorter than keys.
+func (m IntMap[V]) GetMany(keys []IntKey, values []V, found []bool) (n int) {
+	checkMany("GetMany", len(keys), len(values), found)
+	values = values[:len(keys)]
+	if found != nil {
+		found = found[:len(keys)]
+	}
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		kb := intbytes(keys[i])
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(kb[:])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		var v *V
+		if item, _, ok := b.next(bk.path); !ok {
+			v = m.Ptr(key)
+		} else if item != nil {
+			if IntKey(item.pmap)|(IntKey(item.tmap)<<32) == key {
+				v = &(*intkv[V])(item.ptr).v
+			}
+		}
+		if v != nil {
+			values[bk.i] = *v
+			n++
+		} else {
+			var zero V
+			values[bk.i] = zero
+		}
+		if found != nil {
+			found[bk.i] = v != nil
+		}
+	}
+	return n
+}
+
+// SetMany adds or updates the value for each key to the value in values at the index of the key,
+// as if Set were called for each key in order. Keys are hashed and sorted by hash path before
+// walking m once. It panics if values is shorter than keys.
+func (m IntMap[V]) SetMany(keys []IntKey, values []V) {
+	checkMany("SetMany", len(keys), len(values), nil)
+	values = values[:len(keys)]
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		kb := intbytes(keys[i])
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(kb[:])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key, value := keys[bk.i], values[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			m.Set(key, value)
+			b.reset()
+			continue
+		}
+		if item == nil {
+			b.insert(d, link{ptr: unsafe.Pointer(newItem(m.root, intkv[V]{value})), pmap: uint32(key), tmap: uint32(key >> 32)})
+			continue
+		}
+		if IntKey(item.pmap)|(IntKey(item.tmap)<<32) == key { // update existing
+			(*intkv[V])(item.ptr).v = value
+			continue
+		}
+		// rehash conflicting key
+		kb, ckb := intbytes(key), intbytes(IntKey(item.pmap)|(IntKey(item.tmap)<<32))
+		var hw, chw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(kb[:])
+		chw.SetSeed(m.seed)
+		chw.Write(ckb[:])
+		b.branch(item, d, bk.hash>>(4*d), chw.Sum64()>>(4*d), func() (uint64, uint64) {
+			hw.Write(kb[:])
+			chw.Write(ckb[:])
+			return hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(newItem(m.root, intkv[V]{value})), pmap: uint32(key), tmap: uint32(key >> 32)})
+	}
+}
+
+// DelMany deletes the values for keys. Keys are hashed and sorted by hash path before walking
+// m once. It returns the number of values deleted.
+func (m IntMap[V]) DelMany(keys []IntKey) (n int) {
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		kb := intbytes(keys[i])
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.Write(kb[:])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			if _, ok := m.Delete(key); ok {
+				n++
+			}
+			b.reset()
+		} else if item != nil && IntKey(item.pmap)|(IntKey(item.tmap)<<32) == key {
+			b.remove(d)
+			n++
+		}
+	}
+	return n
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (m IntMap[V]) itemHash(item *link) uint64 {
+	kb := intbytes(IntKey(item.pmap) | (IntKey(item.tmap) << 32))
+	var hw maphash.Hash
+	hw.SetSeed(m.seed)
+	hw.Write(kb[:])
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in m, and false if m is empty. The keys in m are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// m is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (m IntMap[V]) RandomKey(rng *rand.Rand) (key IntKey, ok bool) {
+	item := m.randomItem(rng, m.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return IntKey(item.pmap) | (IntKey(item.tmap) << 32), true
+}
+
+// Sample returns up to n distinct keys in m, chosen uniformly at random. If n is at most half
+// the length of m, keys are selected as in RandomKey. Otherwise m is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (m IntMap[V]) Sample(n int, rng *rand.Rand) []IntKey {
+	items := m.sample(n, rng, m.itemHash)
+	keys := make([]IntKey, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = IntKey(item.pmap) | (IntKey(item.tmap) << 32)
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key-value from m, returning the key, value, and true
+// if m was not empty. The key-value is selected as in RandomKey, and unlinked through the path
+// traversed during selection. If rng is nil, the default source of math/rand is used.
+func (m IntMap[V]) PopRandom(rng *rand.Rand) (key IntKey, value V, ok bool) {
+	item, ok := m.popRandom(rng, m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	return IntKey(item.pmap) | (IntKey(item.tmap) << 32), (*intkv[V])(item.ptr).v, true
+}
@@ -25,6 +25,7 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
 	"unsafe"
 )
 
@@ -35,8 +36,8 @@ type IntSet struct {
 }
 
 // NewIntSet returns an initialized set. The set value is safe to copy.
-func NewIntSet() IntSet {
-	return IntSet{newRoot()}
+func NewIntSet(opts ...Option) IntSet {
+	return IntSet{newRoot(opts...)}
 }
 
 // Nil returns true if s is not initialized.
@@ -80,11 +81,17 @@ func (s IntSet) Has(key IntKey) bool {
 
 // Add adds key to s.
 func (s IntSet) Add(key IntKey) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s IntSet) Insert(key IntKey) bool {
 	kb := intbytes(key)
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -104,7 +111,7 @@ func (s IntSet) Add(key IntKey) {
 		}
 		ckey := IntKey(item.pmap) | (IntKey(item.tmap) << 32)
 		if ckey == key { // exists
-			return
+			return false
 		}
 		// rehash conflicting key
 		ckb := intbytes(ckey)
@@ -131,7 +138,7 @@ func (s IntSet) Add(key IntKey) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
+				item.ptr = s.newLinkArray(2)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0] = link{pmap: uint32(key), tmap: uint32(key >> 32)}
 					pair[1] = link{pmap: uint32(ckey), tmap: uint32(ckey >> 32)}
@@ -139,12 +146,13 @@ func (s IntSet) Add(key IntKey) {
 					pair[0] = link{pmap: uint32(ckey), tmap: uint32(ckey >> 32)}
 					pair[1] = link{pmap: uint32(key), tmap: uint32(key >> 32)}
 				}
-				s.len++
+				s.added(hash)
 				s.dep += uint64(d) * 2
-				return // key added
+				return true // key added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.tmap = 0 // clear the inline conflicting key
+			item.ptr = s.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -160,7 +168,7 @@ func (s IntSet) Add(key IntKey) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = s.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -176,18 +184,25 @@ func (s IntSet) Add(key IntKey) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	s.len++
+	s.added(hash)
 	s.dep += uint64(d)
+	return true // key added
 }
 
 // Del deletes key from s.
 func (s IntSet) Del(key IntKey) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s IntSet) Remove(key IntKey) bool {
 	path := s.path[:0]
 	kb := intbytes(key)
 	var hw maphash.Hash
 	hw.SetSeed(s.seed)
 	hw.Write(kb[:])
-	hd, l, d := hw.Sum64(), &s.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &s.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -207,11 +222,11 @@ func (s IntSet) Del(key IntKey) {
 			continue
 		}
 		if k := IntKey(item.pmap) | (IntKey(item.tmap) << 32); k != key { // key missing
-			return
+			return false
 		}
 		l.pmap &^= bit
 		l.tmap &^= bit
-		s.len--
+		s.removed(hash)
 		s.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -229,7 +244,7 @@ func (s IntSet) Del(key IntKey) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = s.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -254,31 +269,166 @@ func (s IntSet) Del(key IntKey) {
 			d--
 			path[d].link = nil
 		}
-		return // item removed
+		return true // item removed
 	}
+	return false // item missing
 }
 
 // All ranges over keys in s, applying the do callback to each key until
 // the callback returns false or all keys have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (s IntSet) All(do func(IntKey) bool) {
-	intSetScan(&s.link, do)
+	intSetScan(&s.link, s.order(), do)
 }
 
-func intSetScan(l *link, do func(IntKey) bool) bool {
+func intSetScan(l *link, rot uint64, do func(IntKey) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			if k := IntKey(item.pmap) | (IntKey(item.tmap) << 32); !do(k) {
 				return false
 			}
-		} else if !intSetScan(item, do) {
+		} else if !intSetScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// IntSetPart is a view of the keys within a contiguous range of hashes in a set.
+// A part is invalidated when the set is modified.
+type IntSetPart struct {
+	part
+}
+
+// Partition splits s into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in s. Parts agree only between sets with the seed of s, such as the copies of s
+// and the sets returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when s is modified.
+func (s IntSet) Partition(n uint) []IntSetPart {
+	return partition(s.root, n, s.itemHash, func(p part) IntSetPart { return IntSetPart{p} })
+}
+
+// PartitionFunc splits s into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in s. Unlike Partition, the part of a key depends only on
+// hash, so sets with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of s. Parts are invalidated
+// when s is modified.
+func (s IntSet) PartitionFunc(n uint, hash func(IntKey) uint64) []IntSetPart {
+	key := func(item *link) uint64 { return hash(IntKey(item.pmap) | IntKey(item.tmap)<<32) }
+	return partitionFunc(s.root, n, key, func(p part) IntSetPart { return IntSetPart{p} })
+}
+
+// All ranges over keys in p, applying the do callback to each key until
+// the callback returns false or all keys have been visited.
+func (p IntSetPart) All(do func(IntKey) bool) {
+	p.scan(func(item *link) bool {
+		return do(IntKey(item.pmap) | (IntKey(item.tmap) << 32))
+	})
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays of s are retained for reuse when keys are added.
+func (s IntSet) Clear() {
+	s.clear(nil) // keys are stored inline without key-values
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s IntSet) Retain(keep func(IntKey) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep(IntKey(item.pmap) | (IntKey(item.tmap) << 32))
+	})
+}
+
+// Drain moves all keys out of s, leaving s and every copy of s empty, into two new sets with the
+// seed and options of s: match, containing the keys for which the pred callback returns true, and
+// rest, containing all other keys. Keys are not rehashed, and sub-tries are moved without copying
+// when pred returns the same result for all of their keys. The pred callback must not modify s.
+func (s IntSet) Drain(pred func(IntKey) bool) (match, rest IntSet) {
+	mr, rr := s.splitRoot(func(item *link) bool {
+		return pred(IntKey(item.pmap) | (IntKey(item.tmap) << 32))
+	})
+	return IntSet{mr}, IntSet{rr}
+}
+
+// NewIntSetFrom returns an initialized set containing the keys in src.
+// The set value is safe to copy.
+func NewIntSetFrom(src []IntKey, opts ...Option) IntSet {
+	s := NewIntSet(opts...)
+	for _, k := range src {
+		s.Add(k)
+	}
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s IntSet) ToSlice() []IntKey {
+	dst := make([]IntKey, 0, s.len)
+	intSetScan(&s.link, s.order(), func(k IntKey) bool {
+		dst = append(dst, k)
+		return true
+	})
+	return dst
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (s IntSet) itemHash(item *link) uint64 {
+	kb := intbytes(IntKey(item.pmap) | (IntKey(item.tmap) << 32))
+	var hw maphash.Hash
+	hw.SetSeed(s.seed)
+	hw.Write(kb[:])
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in s, and false if s is empty. The keys in s are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// s is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (s IntSet) RandomKey(rng *rand.Rand) (key IntKey, ok bool) {
+	item := s.randomItem(rng, s.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return IntKey(item.pmap) | (IntKey(item.tmap) << 32), true
+}
+
+// Sample returns up to n distinct keys in s, chosen uniformly at random. If n is at most half
+// the length of s, keys are selected as in RandomKey. Otherwise s is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (s IntSet) Sample(n int, rng *rand.Rand) []IntKey {
+	items := s.sample(n, rng, s.itemHash)
+	keys := make([]IntKey, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = IntKey(item.pmap) | (IntKey(item.tmap) << 32)
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key from s, returning the key and true if s was not
+// empty. The key is selected as in RandomKey, and unlinked through the path traversed during
+// selection. If rng is nil, the default source of math/rand is used.
+func (s IntSet) PopRandom(rng *rand.Rand) (key IntKey, ok bool) {
+	item, ok := s.popRandom(rng, s.itemHash)
+	if !ok {
+		return key, false
+	}
+	return IntKey(item.pmap) | (IntKey(item.tmap) << 32), true
+}
@@ -0,0 +1,285 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sort"
+	"unsafe"
+)
+
+// Integer is a constraint for the key types of IntegerMap[K, V] and IntegerSet[K].
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntegerMap maps integers of type K to values. Keys are stored inline within each leaf link,
+// as in IntMap[V], and only the bytes within the width of K are hashed. Methods on a map value
+// will panic if the map is not initialized. A map value is safe to copy.
+type IntegerMap[K Integer, V any] struct {
+	*root
+}
+
+// NewIntegerMap returns an initialized map. The map value is safe to copy.
+func NewIntegerMap[K Integer, V any](opts ...Option) IntegerMap[K, V] {
+	return IntegerMap[K, V]{newRoot(opts...)}
+}
+
+// integerHasher writes the bytes within the width of an integer key to a hash.
+type integerHasher struct {
+	hw maphash.Hash
+	kb [8]byte
+	n  uintptr
+}
+
+func newIntegerHasher[K Integer](seed maphash.Seed, key K) (h integerHasher) {
+	h.kb, h.n = intbytes(IntKey(key)), unsafe.Sizeof(key)
+	h.hw.SetSeed(seed)
+	return h
+}
+
+// next writes the key to the hash again, returning the hash for the next 16 levels.
+func (h *integerHasher) next() uint64 {
+	h.hw.Write(h.kb[:h.n])
+	return h.hw.Sum64()
+}
+
+// integerKey returns the key stored inline within the key-value link l.
+func integerKey[K Integer](l *link) K {
+	return K(uint64(l.pmap) | (uint64(l.tmap) << 32))
+}
+
+// integerLink returns a key-value link with key stored inline.
+func integerLink[K Integer](key K, ptr unsafe.Pointer) link {
+	return link{ptr: ptr, pmap: uint32(uint64(key)), tmap: uint32(uint64(key) >> 32)}
+}
+
+// findInteger returns the key-value link for key within r, or nil if key is missing.
+func findInteger[K Integer](r *root, key K) *link {
+	h := newIntegerHasher(r.seed, key)
+	hd, l, d := h.next(), &r.link, uint8(0)
+	for {
+		bit := uint32(1) << uint8(hd&0xF)
+		if l.pmap&bit == 0 { // item missing
+			return nil
+		}
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			if integerKey[K](item) == key { // key match
+				return item
+			}
+			return nil // key mismatch
+		}
+		l = item // traverse branch
+		d++
+		if d%(64/4) != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = h.next()
+		}
+	}
+}
+
+// insertInteger returns the key-value link for key within r and true if key exists. Otherwise,
+// it inserts a link for key with the pointer returned by the alloc callback, and returns the
+// inserted link and false.
+func insertInteger[K Integer](r *root, key K, alloc func() unsafe.Pointer) (*link, bool) {
+	h := newIntegerHasher(r.seed, key)
+	hash := h.next()
+	hd, l, d := hash, &r.link, uint8(0)
+	for {
+		radix := uint8(hd & 0xF)
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 { // item missing
+			return r.insertItem(l, d, radix, hash, integerLink(key, alloc())), false
+		}
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			ckey := integerKey[K](item)
+			if ckey == key { // key exists
+				return item, true
+			}
+			// rehash conflicting key
+			ch := newIntegerHasher(r.seed, ckey)
+			var chd uint64
+			for cd := uint8(0); cd <= d; cd += (64 / 4) {
+				chd = ch.next()
+			}
+			chd >>= 4 * (d % (64 / 4))
+			return r.branchItems(l, item, d, radix, hash, hd, chd, func() (uint64, uint64) {
+				return h.next(), ch.next()
+			}, integerLink(key, alloc())), false
+		}
+		l = item // traverse branch
+		d++
+		if d%(64/4) != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = h.next()
+		}
+	}
+}
+
+// removeInteger removes the key-value link for key within r, returning the removed link and
+// true if key existed.
+func removeInteger[K Integer](r *root, key K) (link, bool) {
+	path := r.path[:0]
+	h := newIntegerHasher(r.seed, key)
+	hash := h.next()
+	hd, l, d := hash, &r.link, uint8(0)
+	for {
+		radix := uint8(hd & 0xF)
+		bit := uint32(1) << radix
+		if l.pmap&bit == 0 { // item missing
+			return link{}, false
+		}
+		path = append(path, pathLink{radix, l})
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(bits.OnesCount32(l.pmap&(bit-1)))*linkSize))
+		if l.tmap&bit != 0 {
+			if integerKey[K](item) != key { // key missing
+				return link{}, false
+			}
+			kv := *item
+			r.unlink(path, d, hash)
+			return kv, true
+		}
+		l = item // traverse branch
+		d++
+		if d%(64/4) != 0 { // hash bits available
+			hd >>= 4
+		} else { // rehash
+			hd = h.next()
+		}
+	}
+}
+
+// Nil returns true if m is not initialized.
+func (m IntegerMap[K, V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m IntegerMap[K, V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m IntegerMap[K, V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m IntegerMap[K, V]) Get(key K) (value V, ok bool) {
+	if ptr := m.Ptr(key); ptr != nil {
+		value, ok = *ptr, true
+	}
+	return
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m IntegerMap[K, V]) Val(key K) (value V) {
+	if m.root != nil {
+		if ptr := m.Ptr(key); ptr != nil {
+			value = *ptr
+		}
+	}
+	return
+}
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m IntegerMap[K, V]) Ptr(key K) *V {
+	if item := findInteger(m.root, key); item != nil {
+		return &(*intkv[V])(item.ptr).v
+	}
+	return nil
+}
+
+// Set adds or updates the value for key.
+func (m IntegerMap[K, V]) Set(key K, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m IntegerMap[K, V]) Swap(key K, value V) (old V, existed bool) {
+	item, existed := insertInteger(m.root, key, m.newValue)
+	kv := (*intkv[V])(item.ptr)
+	old, kv.v = kv.v, value
+	return old, existed
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed.
+func (m IntegerMap[K, V]) Mod(key K, mod func(*V, bool)) {
+	item, existed := insertInteger(m.root, key, m.newValue)
+	mod(&(*intkv[V])(item.ptr).v, existed)
+}
+
+func (m IntegerMap[K, V]) newValue() unsafe.Pointer {
+	return unsafe.Pointer(newItem(m.root, intkv[V]{}))
+}
+
+// Del deletes the value for key.
+func (m IntegerMap[K, V]) Del(key K) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m IntegerMap[K, V]) Delete(key K) (old V, existed bool) {
+	if item, ok := removeInteger(m.root, key); ok {
+		return (*intkv[V])(item.ptr).v, true
+	}
+	return old, false
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m IntegerMap[K, V]) All(do func(K, *V) bool) {
+	intScan(&m.link, m.order(), func(k IntKey, v *V) bool { return do(K(k), v) })
+}
+
+// SortedKeys returns the keys in m in ascending order.
+func (m IntegerMap[K, V]) SortedKeys() []K {
+	keys := make([]K, 0, m.len)
+	intScan(&m.link, 0, func(k IntKey, _ *V) bool {
+		keys = append(keys, K(k))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m IntegerMap[K, V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*intkv[V])(p) = intkv[V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m IntegerMap[K, V]) Retain(keep func(K, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		return keep(integerKey[K](item), &(*intkv[V])(item.ptr).v)
+	})
+}
@@ -0,0 +1,133 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// IntegerSet contains a set of integers of type K. Keys are stored inline within each leaf link,
+// as in IntSet, and only the bytes within the width of K are hashed. Methods on a set value will
+// panic if the set is not initialized. A set value is safe to copy.
+type IntegerSet[K Integer] struct {
+	*root
+}
+
+// NewIntegerSet returns an initialized set. The set value is safe to copy.
+func NewIntegerSet[K Integer](opts ...Option) IntegerSet[K] {
+	return IntegerSet[K]{newRoot(opts...)}
+}
+
+// Nil returns true if s is not initialized.
+func (s IntegerSet[K]) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s IntegerSet[K]) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s IntegerSet[K]) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if s contains key.
+func (s IntegerSet[K]) Has(key K) bool {
+	return findInteger(s.root, key) != nil
+}
+
+// Add adds key to s.
+func (s IntegerSet[K]) Add(key K) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s IntegerSet[K]) Insert(key K) bool {
+	_, existed := insertInteger(s.root, key, noItem)
+	return !existed
+}
+
+// Del deletes key from s.
+func (s IntegerSet[K]) Del(key K) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s IntegerSet[K]) Remove(key K) bool {
+	_, existed := removeInteger(s.root, key)
+	return existed
+}
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s IntegerSet[K]) All(do func(K) bool) {
+	intSetScan(&s.link, s.order(), func(k IntKey) bool { return do(K(k)) })
+}
+
+// SortedKeys returns the keys in s in ascending order.
+func (s IntegerSet[K]) SortedKeys() []K {
+	keys := make([]K, 0, s.len)
+	intSetScan(&s.link, 0, func(k IntKey) bool {
+		keys = append(keys, K(k))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays of s are retained for reuse when keys are added.
+func (s IntegerSet[K]) Clear() {
+	s.clear(nil) // keys are stored inline without key-values
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s IntegerSet[K]) Retain(keep func(K) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep(integerKey[K](item))
+	})
+}
+
+// NewIntegerSetFrom returns an initialized set containing the keys in src. Keys are stored
+// inline, so no key-values are allocated. The set value is safe to copy.
+func NewIntegerSetFrom[K Integer](src []K, opts ...Option) IntegerSet[K] {
+	s := NewIntegerSet[K](opts...)
+	for _, k := range src {
+		s.Add(k)
+	}
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s IntegerSet[K]) ToSlice() []K {
+	dst := make([]K, 0, s.len)
+	intSetScan(&s.link, s.order(), func(k IntKey) bool {
+		dst = append(dst, K(k))
+		return true
+	})
+	return dst
+}
+
+// noItem is the alloc callback for keys stored inline without key-values.
+func noItem() unsafe.Pointer { return nil }
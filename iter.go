@@ -0,0 +1,177 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+// The functions below accept the All method of a map, set, or partition, for example
+// Fold(m.All, 0, sum) or CountSetIf(s.All, even). Map functions accept an All method
+// with a key-value callback, and each has a set counterpart with the same name and a Set
+// infix, which accepts an All method with a key callback.
+
+// Fold applies the fn callback to each key and value in a map, accumulating a result
+// starting from init.
+func Fold[K, V, A any](all func(func(K, *V) bool), init A, fn func(A, K, *V) A) A {
+	acc := init
+	all(func(k K, v *V) bool {
+		acc = fn(acc, k, v)
+		return true
+	})
+	return acc
+}
+
+// CountIf returns the number of values in a map for which the pred callback returns true.
+func CountIf[K, V any](all func(func(K, *V) bool), pred func(K, *V) bool) uint {
+	var n uint
+	all(func(k K, v *V) bool {
+		if pred(k, v) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// AnyMatch returns true if the pred callback returns true for any value in a map.
+// The iteration stops at the first match.
+func AnyMatch[K, V any](all func(func(K, *V) bool), pred func(K, *V) bool) bool {
+	var match bool
+	all(func(k K, v *V) bool {
+		match = pred(k, v)
+		return !match
+	})
+	return match
+}
+
+// AllMatch returns true if the pred callback returns true for all values in a map, or if
+// the map is empty. The iteration stops at the first mismatch.
+func AllMatch[K, V any](all func(func(K, *V) bool), pred func(K, *V) bool) bool {
+	match := true
+	all(func(k K, v *V) bool {
+		match = pred(k, v)
+		return match
+	})
+	return match
+}
+
+// FoldSet applies the fn callback to each key in a set, accumulating a result
+// starting from init.
+func FoldSet[K, A any](all func(func(K) bool), init A, fn func(A, K) A) A {
+	acc := init
+	all(func(k K) bool {
+		acc = fn(acc, k)
+		return true
+	})
+	return acc
+}
+
+// CountSetIf returns the number of keys in a set for which the pred callback returns true.
+func CountSetIf[K any](all func(func(K) bool), pred func(K) bool) uint {
+	var n uint
+	all(func(k K) bool {
+		if pred(k) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// AnySetMatch returns true if the pred callback returns true for any key in a set.
+// The iteration stops at the first match.
+func AnySetMatch[K any](all func(func(K) bool), pred func(K) bool) bool {
+	var match bool
+	all(func(k K) bool {
+		match = pred(k)
+		return !match
+	})
+	return match
+}
+
+// AllSetMatch returns true if the pred callback returns true for all keys in a set, or if
+// the set is empty. The iteration stops at the first mismatch.
+func AllSetMatch[K any](all func(func(K) bool), pred func(K) bool) bool {
+	match := true
+	all(func(k K) bool {
+		match = pred(k)
+		return match
+	})
+	return match
+}
+
+// GroupBy returns a map from each group key to the set of elements within the group, where
+// the group key of each element is the result of the key callback. The src argument is the
+// All method of a set or partition, or a function which ranges over elements in the same way.
+// Each element is added to its group with a single map traversal.
+func GroupBy[K Key[K], E Key[E]](src func(func(E) bool), key func(E) K) Map[K, Set[E]] {
+	groups := NewMap[K, Set[E]]()
+	var e E
+	add := func(group *Set[E], ok bool) {
+		if !ok {
+			*group = NewSet[E]()
+		}
+		group.Add(e)
+	}
+	src(func(elem E) bool {
+		e = elem
+		groups.Mod(key(e), add)
+		return true
+	})
+	return groups
+}
+
+// GroupByString returns a map from each group key to the set of strings within the group.
+// See GroupBy.
+func GroupByString(src func(func(string) bool), key func(string) string) StringMap[StringSet] {
+	groups := NewStringMap[StringSet]()
+	var e string
+	add := func(group *StringSet, ok bool) {
+		if !ok {
+			*group = NewStringSet()
+		}
+		group.Add(e)
+	}
+	src(func(elem string) bool {
+		e = elem
+		groups.Mod(key(e), add)
+		return true
+	})
+	return groups
+}
+
+// GroupByInt returns a map from each group key to the set of integers within the group.
+// See GroupBy.
+func GroupByInt(src func(func(IntKey) bool), key func(IntKey) IntKey) IntMap[IntSet] {
+	groups := NewIntMap[IntSet]()
+	var e IntKey
+	add := func(group *IntSet, ok bool) {
+		if !ok {
+			*group = NewIntSet()
+		}
+		group.Add(e)
+	}
+	src(func(elem IntKey) bool {
+		e = elem
+		groups.Mod(key(e), add)
+		return true
+	})
+	return groups
+}
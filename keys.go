@@ -0,0 +1,296 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"hash/maphash"
+	"math"
+	"time"
+)
+
+// Int may be used as the key type of a generic Map[Int, V] or Set[Int].
+type Int int
+
+// Int8 may be used as the key type of a generic Map[Int8, V] or Set[Int8].
+type Int8 int8
+
+// Int16 may be used as the key type of a generic Map[Int16, V] or Set[Int16].
+type Int16 int16
+
+// Int32 may be used as the key type of a generic Map[Int32, V] or Set[Int32].
+type Int32 int32
+
+// Int64 may be used as the key type of a generic Map[Int64, V] or Set[Int64].
+type Int64 int64
+
+// Uint may be used as the key type of a generic Map[Uint, V] or Set[Uint].
+type Uint uint
+
+// Uint8 may be used as the key type of a generic Map[Uint8, V] or Set[Uint8].
+type Uint8 uint8
+
+// Byte may be used as the key type of a generic Map[Byte, V] or Set[Byte].
+type Byte byte
+
+// Uint16 may be used as the key type of a generic Map[Uint16, V] or Set[Uint16].
+type Uint16 uint16
+
+// Uint32 may be used as the key type of a generic Map[Uint32, V] or Set[Uint32].
+type Uint32 uint32
+
+// Uint64 may be used as the key type of a generic Map[Uint64, V] or Set[Uint64].
+type Uint64 uint64
+
+// Uintptr may be used as the key type of a generic Map[Uintptr, V] or Set[Uintptr].
+type Uintptr uintptr
+
+// Rune may be used as the key type of a generic Map[Rune, V] or Set[Rune].
+type Rune rune
+
+// Bool may be used as the key type of a generic Map[Bool, V] or Set[Bool].
+type Bool bool
+
+// Float32 may be used as the key type of a generic Map[Float32, V] or Set[Float32].
+// Negative and positive zero are equal keys, and all NaN values are equal to each other,
+// so a map may contain at most one NaN key.
+type Float32 float32
+
+// Float64 may be used as the key type of a generic Map[Float64, V] or Set[Float64].
+// Negative and positive zero are equal keys, and all NaN values are equal to each other,
+// so a map may contain at most one NaN key.
+type Float64 float64
+
+// Time may be used as the key type of a generic Map[Time, V] or Set[Time]. Times are equal
+// if they represent the same instant, regardless of their locations or monotonic clock readings.
+type Time time.Time
+
+// hashWord hashes the 8 bytes of w 1 or more times, as in HashBytes.
+func hashWord(w uint64, seed maphash.Seed, iter uint) uint64 {
+	b := intbytes(IntKey(w))
+	var hw maphash.Hash
+	hw.SetSeed(seed)
+	for i := uint(0); i <= iter; i++ {
+		hw.Write(b[:])
+	}
+	return hw.Sum64()
+}
+
+func (i Int) Equal(c Int) bool { return i == c }
+
+func (i Int) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(i), seed, iter) }
+
+func (i Int8) Equal(c Int8) bool { return i == c }
+
+func (i Int8) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(i), seed, iter) }
+
+func (i Int16) Equal(c Int16) bool { return i == c }
+
+func (i Int16) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(i), seed, iter) }
+
+func (i Int32) Equal(c Int32) bool { return i == c }
+
+func (i Int32) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(i), seed, iter) }
+
+func (i Int64) Equal(c Int64) bool { return i == c }
+
+func (i Int64) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(i), seed, iter) }
+
+func (u Uint) Equal(c Uint) bool { return u == c }
+
+func (u Uint) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (u Uint8) Equal(c Uint8) bool { return u == c }
+
+func (u Uint8) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (b Byte) Equal(c Byte) bool { return b == c }
+
+func (b Byte) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(b), seed, iter) }
+
+func (u Uint16) Equal(c Uint16) bool { return u == c }
+
+func (u Uint16) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (u Uint32) Equal(c Uint32) bool { return u == c }
+
+func (u Uint32) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (u Uint64) Equal(c Uint64) bool { return u == c }
+
+func (u Uint64) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (u Uintptr) Equal(c Uintptr) bool { return u == c }
+
+func (u Uintptr) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(u), seed, iter) }
+
+func (r Rune) Equal(c Rune) bool { return r == c }
+
+func (r Rune) Hash(seed maphash.Seed, iter uint) uint64 { return hashWord(uint64(r), seed, iter) }
+
+func (b Bool) Equal(c Bool) bool { return b == c }
+
+func (b Bool) Hash(seed maphash.Seed, iter uint) uint64 {
+	if b {
+		return hashWord(1, seed, iter)
+	}
+	return hashWord(0, seed, iter)
+}
+
+func (f Float32) Equal(c Float32) bool { return f == c || (f != f && c != c) }
+
+func (f Float32) Hash(seed maphash.Seed, iter uint) uint64 {
+	switch {
+	case f == 0: // negative zero
+		f = 0
+	case f != f: // NaN
+		f = Float32(math.NaN())
+	}
+	return hashWord(uint64(math.Float32bits(float32(f))), seed, iter)
+}
+
+func (f Float64) Equal(c Float64) bool { return f == c || (f != f && c != c) }
+
+func (f Float64) Hash(seed maphash.Seed, iter uint) uint64 {
+	switch {
+	case f == 0: // negative zero
+		f = 0
+	case f != f: // NaN
+		f = Float64(math.NaN())
+	}
+	return hashWord(math.Float64bits(float64(f)), seed, iter)
+}
+
+func (t Time) Equal(c Time) bool {
+	tt, ct := time.Time(t), time.Time(c)
+	return tt.Unix() == ct.Unix() && tt.Nanosecond() == ct.Nanosecond()
+}
+
+func (t Time) Hash(seed maphash.Seed, iter uint) uint64 {
+	tt := time.Time(t)
+	b, n := intbytes(tt.Unix()), intbytes(IntKey(tt.Nanosecond()))
+	var hw maphash.Hash
+	hw.SetSeed(seed)
+	for i := uint(0); i <= iter; i++ {
+		hw.Write(b[:])
+		hw.Write(n[:4])
+	}
+	return hw.Sum64()
+}
+
+// Pair may be used as the key type of a generic Map[Pair[A, B], V] or Set[Pair[A, B]], where
+// A and B are Key implementations such as String, Int or another Pair. Pairs are equal if both
+// of their components are equal. See ComparablePair for components of builtin types.
+type Pair[A Key[A], B Key[B]] struct {
+	First  A
+	Second B
+}
+
+// MakePair returns a pair of the keys a and b.
+func MakePair[A Key[A], B Key[B]](a A, b B) Pair[A, B] { return Pair[A, B]{a, b} }
+
+// Triple may be used as the key type of a generic Map[Triple[A, B, C], V] or
+// Set[Triple[A, B, C]], where A, B and C are Key implementations. Triples are equal if all of
+// their components are equal. See ComparableTriple for components of builtin types.
+type Triple[A Key[A], B Key[B], C Key[C]] struct {
+	First  A
+	Second B
+	Third  C
+}
+
+// MakeTriple returns a triple of the keys a, b and c.
+func MakeTriple[A Key[A], B Key[B], C Key[C]](a A, b B, c C) Triple[A, B, C] {
+	return Triple[A, B, C]{a, b, c}
+}
+
+// ComparablePair may be used as the key type of a generic Map[ComparablePair[A, B], V] or
+// Set[ComparablePair[A, B]], where A and B are any comparable types, such as string or int.
+// Pairs are compared with == and hashed as in ComparableMap.
+type ComparablePair[A, B comparable] struct {
+	First  A
+	Second B
+}
+
+// MakeComparablePair returns a pair of the comparable values a and b.
+func MakeComparablePair[A, B comparable](a A, b B) ComparablePair[A, B] {
+	return ComparablePair[A, B]{a, b}
+}
+
+// ComparableTriple may be used as the key type of a generic Map[ComparableTriple[A, B, C], V]
+// or Set[ComparableTriple[A, B, C]], where A, B and C are any comparable types. Triples are
+// compared with == and hashed as in ComparableMap.
+type ComparableTriple[A, B, C comparable] struct {
+	First  A
+	Second B
+	Third  C
+}
+
+// MakeComparableTriple returns a triple of the comparable values a, b and c.
+func MakeComparableTriple[A, B, C comparable](a A, b B, c C) ComparableTriple[A, B, C] {
+	return ComparableTriple[A, B, C]{a, b, c}
+}
+
+// writeHash writes the 8 bytes of a component hash to hw.
+func writeHash(hw *maphash.Hash, h uint64) {
+	b := intbytes(IntKey(h))
+	hw.Write(b[:])
+}
+
+func (p Pair[A, B]) Equal(c Pair[A, B]) bool {
+	return p.First.Equal(c.First) && p.Second.Equal(c.Second)
+}
+
+// Hash combines the hashes of the components of p for the iter count, in order, so the hash
+// of each iteration depends on the corresponding hash of each component.
+func (p Pair[A, B]) Hash(seed maphash.Seed, iter uint) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(seed)
+	writeHash(&hw, p.First.Hash(seed, iter))
+	writeHash(&hw, p.Second.Hash(seed, iter))
+	return hw.Sum64()
+}
+
+func (t Triple[A, B, C]) Equal(c Triple[A, B, C]) bool {
+	return t.First.Equal(c.First) && t.Second.Equal(c.Second) && t.Third.Equal(c.Third)
+}
+
+// Hash combines the hashes of the components of t for the iter count, as in Pair[A, B].Hash.
+func (t Triple[A, B, C]) Hash(seed maphash.Seed, iter uint) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(seed)
+	writeHash(&hw, t.First.Hash(seed, iter))
+	writeHash(&hw, t.Second.Hash(seed, iter))
+	writeHash(&hw, t.Third.Hash(seed, iter))
+	return hw.Sum64()
+}
+
+func (p ComparablePair[A, B]) Equal(c ComparablePair[A, B]) bool { return p == c }
+
+func (p ComparablePair[A, B]) Hash(seed maphash.Seed, iter uint) uint64 {
+	return hashComparable(seed, p, iter)
+}
+
+func (t ComparableTriple[A, B, C]) Equal(c ComparableTriple[A, B, C]) bool { return t == c }
+
+func (t ComparableTriple[A, B, C]) Hash(seed maphash.Seed, iter uint) uint64 {
+	return hashComparable(seed, t, iter)
+}
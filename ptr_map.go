@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// PtrMap maps pointers to values by identity. The address of each key is stored inline within
+// each leaf link, as in IntMap[V], and only the address is hashed, so keys are never dereferenced.
+// Each key-value holds the key pointer, so referents are kept alive while they are in the map.
+// Methods on a map value will panic if the map is not initialized. A map value is safe to copy.
+type PtrMap[T, V any] struct {
+	*root
+}
+type ptrkv[T, V any] struct {
+	// The address of the key is stored inline within the link's pmap and tmap fields.
+	v V
+	p *T // keeps the referent alive
+}
+
+// NewPtrMap returns an initialized map. The map value is safe to copy.
+func NewPtrMap[T, V any](opts ...Option) PtrMap[T, V] {
+	return PtrMap[T, V]{newRoot(opts...)}
+}
+
+// Nil returns true if m is not initialized.
+func (m PtrMap[T, V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m PtrMap[T, V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m PtrMap[T, V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m PtrMap[T, V]) Get(key *T) (value V, ok bool) {
+	if ptr := m.Ptr(key); ptr != nil {
+		value, ok = *ptr, true
+	}
+	return
+}
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m PtrMap[T, V]) Val(key *T) (value V) {
+	if m.root != nil {
+		if ptr := m.Ptr(key); ptr != nil {
+			value = *ptr
+		}
+	}
+	return
+}
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m PtrMap[T, V]) Ptr(key *T) *V {
+	if item := findInteger(m.root, uintptr(unsafe.Pointer(key))); item != nil {
+		return &(*ptrkv[T, V])(item.ptr).v
+	}
+	return nil
+}
+
+// Set adds or updates the value for key.
+func (m PtrMap[T, V]) Set(key *T, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m PtrMap[T, V]) Swap(key *T, value V) (old V, existed bool) {
+	kv, existed := m.insert(key)
+	old, kv.v = kv.v, value
+	return old, existed
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed.
+func (m PtrMap[T, V]) Mod(key *T, mod func(*V, bool)) {
+	kv, existed := m.insert(key)
+	mod(&kv.v, existed)
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m PtrMap[T, V]) GetOrSet(key *T, value V) (actual V, loaded bool) {
+	kv, loaded := m.insert(key)
+	if !loaded {
+		kv.v = value
+	}
+	return kv.v, loaded
+}
+
+func (m PtrMap[T, V]) insert(key *T) (*ptrkv[T, V], bool) {
+	item, existed := insertInteger(m.root, uintptr(unsafe.Pointer(key)), func() unsafe.Pointer {
+		return unsafe.Pointer(newItem(m.root, ptrkv[T, V]{p: key}))
+	})
+	return (*ptrkv[T, V])(item.ptr), existed
+}
+
+// Del deletes the value for key.
+func (m PtrMap[T, V]) Del(key *T) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m PtrMap[T, V]) Delete(key *T) (old V, existed bool) {
+	if item, ok := removeInteger(m.root, uintptr(unsafe.Pointer(key))); ok {
+		return (*ptrkv[T, V])(item.ptr).v, true
+	}
+	return old, false
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m PtrMap[T, V]) All(do func(*T, *V) bool) {
+	ptrScan(&m.link, m.order(), do)
+}
+
+func ptrScan[T, V any](l *link, rot uint64, do func(*T, *V) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
+	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
+		if tmap&bit != 0 {
+			kv := (*ptrkv[T, V])(item.ptr)
+			if !do(kv.p, &kv.v) {
+				return false
+			}
+		} else if !ptrScan(item, bits.RotateLeft64(rot, -4), do) {
+			return false
+		}
+		pmap &^= bit
+		idx++
+	}
+	return true
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m PtrMap[T, V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*ptrkv[T, V])(p) = ptrkv[T, V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m PtrMap[T, V]) Retain(keep func(*T, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*ptrkv[T, V])(item.ptr)
+		return keep(kv.p, &kv.v)
+	})
+}
@@ -0,0 +1,148 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// PtrSet contains a set of pointers, compared by identity. The address of each key is stored
+// inline within each leaf link, as in IntSet, and only the address is hashed, so keys are never
+// dereferenced. Each leaf link also points to its key, so referents are kept alive while they are
+// in the set. Methods on a set value will panic if the set is not initialized. A set value is
+// safe to copy.
+type PtrSet[T any] struct {
+	*root
+}
+
+// NewPtrSet returns an initialized set. The set value is safe to copy.
+func NewPtrSet[T any](opts ...Option) PtrSet[T] {
+	return PtrSet[T]{newRoot(opts...)}
+}
+
+// Nil returns true if s is not initialized.
+func (s PtrSet[T]) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s PtrSet[T]) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s PtrSet[T]) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if s contains key.
+func (s PtrSet[T]) Has(key *T) bool {
+	return findInteger(s.root, uintptr(unsafe.Pointer(key))) != nil
+}
+
+// Add adds key to s.
+func (s PtrSet[T]) Add(key *T) {
+	s.Insert(key)
+}
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s PtrSet[T]) Insert(key *T) bool {
+	_, existed := insertInteger(s.root, uintptr(unsafe.Pointer(key)), func() unsafe.Pointer {
+		return unsafe.Pointer(key)
+	})
+	return !existed
+}
+
+// Del deletes key from s.
+func (s PtrSet[T]) Del(key *T) {
+	s.Remove(key)
+}
+
+// Remove deletes key from s, returning true if key existed.
+func (s PtrSet[T]) Remove(key *T) bool {
+	_, existed := removeInteger(s.root, uintptr(unsafe.Pointer(key)))
+	return existed
+}
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s PtrSet[T]) All(do func(*T) bool) {
+	ptrSetScan(&s.link, s.order(), do)
+}
+
+func ptrSetScan[T any](l *link, rot uint64, do func(*T) bool) bool {
+	pmap, tmap := l.pmap, l.tmap
+	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
+	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
+		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
+		if tmap&bit != 0 {
+			if !do((*T)(item.ptr)) {
+				return false
+			}
+		} else if !ptrSetScan(item, bits.RotateLeft64(rot, -4), do) {
+			return false
+		}
+		pmap &^= bit
+		idx++
+	}
+	return true
+}
+
+// NewPtrSetFrom returns an initialized set containing the keys in src. Keys are stored inline,
+// so no key-values are allocated. The set value is safe to copy.
+func NewPtrSetFrom[T any](src []*T, opts ...Option) PtrSet[T] {
+	s := NewPtrSet[T](opts...)
+	for _, k := range src {
+		s.Add(k)
+	}
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s PtrSet[T]) ToSlice() []*T {
+	dst := make([]*T, 0, s.len)
+	ptrSetScan(&s.link, s.order(), func(k *T) bool {
+		dst = append(dst, k)
+		return true
+	})
+	return dst
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays of s are retained for reuse when keys are added.
+func (s PtrSet[T]) Clear() {
+	s.clear(nil) // keys are not released as key-values
+}
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s PtrSet[T]) Retain(keep func(*T) bool) {
+	s.retain(&s.link, 0, func(item *link) bool {
+		return keep((*T)(item.ptr))
+	})
+}
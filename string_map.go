@@ -25,6 +25,9 @@ package amt
 import (
 	"hash/maphash"
 	"math/bits"
+	"math/rand"
+	"sort"
+	"strings"
 	"unsafe"
 )
 
@@ -53,8 +56,8 @@ type strkv[V any] struct {
 }
 
 // NewStringMap returns an initialized map. The map value is safe to copy.
-func NewStringMap[V any]() StringMap[V] {
-	return StringMap[V]{newRoot()}
+func NewStringMap[V any](opts ...Option) StringMap[V] {
+	return StringMap[V]{newRoot(opts...)}
 }
 
 // Nil returns true if m is not initialized.
@@ -119,10 +122,17 @@ func (m StringMap[V]) Ptr(key string) *V {
 
 // Set adds or updates the value for key.
 func (m StringMap[V]) Set(key string, value V) {
+	m.Swap(key, value)
+}
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m StringMap[V]) Swap(key string, value V) (old V, existed bool) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.WriteString(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -143,8 +153,8 @@ func (m StringMap[V]) Set(key string, value V) {
 		ckv := (*strkv[V])(item.ptr)
 		ckey := ckv.k
 		if ckey == key { // update existing
-			ckv.v = value
-			return
+			old, ckv.v = ckv.v, value
+			return old, true
 		}
 		// rehash conflicting key
 		var chw maphash.Hash
@@ -170,19 +180,19 @@ func (m StringMap[V]) Set(key string, value V) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &strkv[V]{value, key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, strkv[V]{value, key})
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
@@ -193,17 +203,17 @@ func (m StringMap[V]) Set(key string, value V) {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&strkv[V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, strkv[V]{k: key, v: value})),
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
 		}
 		*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize)) = link{
-			ptr: unsafe.Pointer(&strkv[V]{k: key, v: value}),
+			ptr: unsafe.Pointer(newItem(m.root, strkv[V]{k: key, v: value})),
 		}
 		for after := idx; after < count; after++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(after+1)*linkSize)) =
@@ -212,8 +222,9 @@ func (m StringMap[V]) Set(key string, value V) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
+	return // item added
 }
 
 // Mod modifies the value for key using the mod callback. The mod callback receives
@@ -222,7 +233,8 @@ func (m StringMap[V]) Mod(key string, mod func(*V, bool)) {
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.WriteString(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -270,24 +282,24 @@ func (m StringMap[V]) Mod(key string, mod func(*V, bool)) {
 			item.pmap = kbit | cbit
 			if kbit != cbit { // non-colliding
 				item.tmap = item.pmap
-				item.ptr = newLinkArray(2)
-				kv := &strkv[V]{k: key}
+				item.ptr = m.newLinkArray(2)
+				kv := newItem(m.root, strkv[V]{k: key})
 				mod(&kv.v, false)
 				if pair := (*[2]link)(item.ptr); kbit < cbit {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(kv), unsafe.Pointer(ckv)
 				} else {
 					pair[0].ptr, pair[1].ptr = unsafe.Pointer(ckv), unsafe.Pointer(kv)
 				}
-				m.len++
+				m.added(hash)
 				m.dep += uint64(d) * 2
 				return // item added
 			}
 			// handle collision at new level
-			item.ptr = newLinkArray(1)
+			item.ptr = m.newLinkArray(1)
 			item = (*link)(item.ptr)
 		}
 	}
-	kv := &strkv[V]{k: key}
+	kv := newItem(m.root, strkv[V]{k: key})
 	mod(&kv.v, false)
 	count := uint8(bits.OnesCount32(l.pmap))
 	if (count != 0 && count%4 != 0) || d == 0 { // array slot available
@@ -300,7 +312,7 @@ func (m StringMap[V]) Mod(key string, mod func(*V, bool)) {
 		}
 	} else { // array full or empty
 		src := l.ptr
-		l.ptr = newLinkArray(count + 1)
+		l.ptr = m.newLinkArray(count + 1)
 		for before := uint8(0); before < idx; before++ {
 			*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 				*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -315,17 +327,23 @@ func (m StringMap[V]) Mod(key string, mod func(*V, bool)) {
 	}
 	l.pmap |= bit
 	l.tmap |= bit
-	m.len++
+	m.added(hash)
 	m.dep += uint64(d)
 }
 
 // Del deletes the value for key.
 func (m StringMap[V]) Del(key string) {
+	m.Delete(key)
+}
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m StringMap[V]) Delete(key string) (old V, existed bool) {
 	path := m.path[:0]
 	var hw maphash.Hash
 	hw.SetSeed(m.seed)
 	hw.WriteString(key)
-	hd, l, d := hw.Sum64(), &m.link, uint8(0)
+	hash := hw.Sum64()
+	hd, l, d := hash, &m.link, uint8(0)
 	radix := uint8(hd & 0xF)
 	bit, idx := uint32(1)<<radix, uint8(bits.OnesCount32(l.pmap&^(^uint32(0)<<radix)))
 	for l.pmap&bit != 0 { // item present
@@ -347,9 +365,10 @@ func (m StringMap[V]) Del(key string) {
 		if (*strkv[V])(item.ptr).k != key { // key missing
 			return
 		}
+		old, existed = (*strkv[V])(item.ptr).v, true
 		l.pmap &^= bit
 		l.tmap &^= bit
-		m.len--
+		m.removed(hash)
 		m.dep -= uint64(d)
 		path[d].link = nil
 		count := uint8(bits.OnesCount32(l.pmap))
@@ -367,7 +386,7 @@ func (m StringMap[V]) Del(key string) {
 		// shift items back
 		src := l.ptr
 		if count%4 == 0 && d != 0 { // copy all items when reallocating
-			l.ptr = newLinkArray(count)
+			l.ptr = m.newLinkArray(count)
 			for before := uint8(0); before < idx; before++ {
 				*(*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(before)*linkSize)) =
 					*(*link)(unsafe.Pointer(uintptr(src) + uintptr(before)*linkSize))
@@ -394,30 +413,455 @@ func (m StringMap[V]) Del(key string) {
 		}
 		return // item removed
 	}
+	return // item missing
 }
 
 // All ranges over values in m, applying the do callback to each value until
 // the callback returns false or all values have been visited. The iteration order
-// is not randomized for each call.
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
 func (m StringMap[V]) All(do func(string, *V) bool) {
-	stringScan(&m.link, do)
+	stringScan(&m.link, m.order(), do)
 }
 
-func stringScan[V any](l *link, do func(string, *V) bool) bool {
+func stringScan[V any](l *link, rot uint64, do func(string, *V) bool) bool {
 	pmap, tmap := l.pmap, l.tmap
 	count := uint8(bits.OnesCount32(pmap))
+	lo := pmap &^ (^uint32(0) << uint8(rot&0xF)) // items before the starting radix
+	idx := uint8(bits.OnesCount32(lo))
+	pmap &^= lo
 	for i := uint8(0); i < count; i++ {
+		if pmap == 0 { // wrap around to the first item
+			pmap, idx = lo, 0
+		}
 		bit := uint32(1) << uint8(bits.TrailingZeros32(pmap))
-		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(i)*linkSize))
+		item := (*link)(unsafe.Pointer(uintptr(l.ptr) + uintptr(idx)*linkSize))
 		if tmap&bit != 0 {
 			kv := (*strkv[V])(item.ptr)
 			if !do(kv.k, &kv.v) {
 				return false
 			}
-		} else if !stringScan(item, do) {
+		} else if !stringScan(item, bits.RotateLeft64(rot, -4), do) {
 			return false
 		}
 		pmap &^= bit
+		idx++
 	}
 	return true
 }
+
+// SortedAll ranges over values in m in ascending order of keys, applying the do callback
+// to each value until the callback returns false or all values have been visited.
+// Keys are not ordered within a map, so the values of each sub-trie with up to 256 values are
+// ordered by a cursor which buffers its next 32 keys, and cursors are merged through a heap.
+// Memory is used for the cursors rather than for each value in m, and keys are not sorted before
+// the first value is visited. The do callback must not modify m.
+func (m StringMap[V]) SortedAll(do func(string, *V) bool) {
+	sortedScan(&m.link, m.len, func(a, b *link) int {
+		return strings.Compare((*strkv[V])(a.ptr).k, (*strkv[V])(b.ptr).k)
+	}, func(item *link) bool {
+		kv := (*strkv[V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// SortedKeys returns the keys in m in ascending order.
+func (m StringMap[V]) SortedKeys() []string {
+	keys := make([]string, 0, m.len)
+	stringScan(&m.link, 0, func(k string, _ *V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// StringMapPart is a view of the values within a contiguous range of hashes in a map.
+// A part is invalidated when the map is modified.
+type StringMapPart[V any] struct {
+	part
+}
+
+// Partition splits m into n disjoint parts, each covering a contiguous range of hash prefixes.
+// The prefix of a key is its initial hash, with the radix of the root level as the most significant
+// 4 bits, followed by the radix of each sub-trie level, so the part of a key does not depend on the
+// other keys in m. Parts agree only between maps with the seed of m, such as the copies of m
+// and the maps returned by Drain. Seeds are random and cannot be set, so parts do not agree across
+// processes; see PartitionFunc. Parts are invalidated when m is modified.
+func (m StringMap[V]) Partition(n uint) []StringMapPart[V] {
+	return partition(m.root, n, m.itemHash, func(p part) StringMapPart[V] { return StringMapPart[V]{p} })
+}
+
+// PartitionFunc splits m into n disjoint parts, each covering a contiguous range of the results
+// of the hash callback for the keys in m. Unlike Partition, the part of a key depends only on
+// hash, so maps with the same keys have identical parts in every process if hash does not
+// depend on a random seed, as with hash/fnv. Each part scans all of m. Parts are invalidated
+// when m is modified.
+func (m StringMap[V]) PartitionFunc(n uint, hash func(string) uint64) []StringMapPart[V] {
+	key := func(item *link) uint64 { return hash((*strkv[V])(item.ptr).k) }
+	return partitionFunc(m.root, n, key, func(p part) StringMapPart[V] { return StringMapPart[V]{p} })
+}
+
+// All ranges over values in p, applying the do callback to each value until
+// the callback returns false or all values have been visited.
+func (p StringMapPart[V]) All(do func(string, *V) bool) {
+	p.scan(func(item *link) bool {
+		kv := (*strkv[V])(item.ptr)
+		return do(kv.k, &kv.v)
+	})
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m StringMap[V]) Clear() {
+	m.clear(func(p unsafe.Pointer) { *(*strkv[V])(p) = strkv[V]{} })
+}
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m StringMap[V]) Retain(keep func(string, *V) bool) {
+	m.retain(&m.link, 0, func(item *link) bool {
+		kv := (*strkv[V])(item.ptr)
+		return keep(kv.k, &kv.v)
+	})
+}
+
+// MapStringValues returns a new map with the keys of m, where the value for each key is the
+// result of the fn callback. The new map has the same seed and layout as m, so keys are not
+// rehashed or compared.
+func MapStringValues[V, W any](m StringMap[V], fn func(string, *V) W) StringMap[W] {
+	return StringMap[W]{m.cloneRoot(func(dst, src *link) {
+		kv := (*strkv[V])(src.ptr)
+		dst.ptr = unsafe.Pointer(&strkv[W]{fn(kv.k, &kv.v), kv.k})
+	})}
+}
+
+// Drain moves all values out of m, leaving m and every copy of m empty, into two new maps with the
+// seed and options of m: match, containing the values for which the pred callback returns true,
+// and rest, containing all other values. Keys are not rehashed, and sub-tries are moved without
+// copying when pred returns the same result for all of their values. The pred callback must not
+// modify m.
+func (m StringMap[V]) Drain(pred func(string, *V) bool) (match, rest StringMap[V]) {
+	mr, rr := m.splitRoot(func(item *link) bool {
+		kv := (*strkv[V])(item.ptr)
+		return pred(kv.k, &kv.v)
+	})
+	return StringMap[V]{mr}, StringMap[V]{rr}
+}
+
+// NewStringMapFrom returns an initialized map containing the key-values in src. Key-values
+// are allocated in blocks of up to 64, so each block is retained while any of its key-values
+// remain in the map. The map value is safe to copy.
+func NewStringMapFrom[V any](src map[string]V, opts ...Option) StringMap[V] {
+	m := NewStringMap[V](opts...)
+	reserveItems[strkv[V]](m.root, len(src))
+	for k, v := range src {
+		m.Set(k, v)
+	}
+	m.dropReserved()
+	return m
+}
+
+// ToMap returns a builtin map containing the key-values in m.
+func (m StringMap[V]) ToMap() map[string]V {
+	dst := make(map[string]V, m.len)
+	stringScan(&m.link, 0, func(k string, v *V) bool {
+		dst[k] = *v
+		return true
+	})
+	return dst
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m StringMap[V]) KeySet() StringSet {
+	return StringSet{m.cloneRoot(func(dst, src *link) {
+		dst.ptr = unsafe.Pointer(&strkv[struct{}]{k: (*strkv[V])(src.ptr).k})
+	})}
+}
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m StringMap[V]) GetOrSet(key string, value V) (actual V, loaded bool) {
+	m.Mod(key, func(v *V, ok bool) {
+		if !ok {
+			*v = value
+		}
+		actual, loaded = *v, ok
+	})
+	return actual, loaded
+}
+
+// CompareAndSwapFunc swaps the old and new values for key if key exists and its value
+// is equal to old, according to the eq callback. It returns true if the value was swapped.
+func (m StringMap[V]) CompareAndSwapFunc(key string, old, new V, eq func(V, V) bool) (swapped bool) {
+	if v := m.Ptr(key); v != nil && eq(*v, old) {
+		*v = new
+		return true
+	}
+	return false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value and true if key
+// existed. It is equivalent to Delete.
+func (m StringMap[V]) LoadAndDelete(key string) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// PopAny removes an arbitrary key-value from m, returning the key, value, and true if m
+// was not empty.
+func (m StringMap[V]) PopAny() (key string, value V, ok bool) {
+	item, ok := m.popAny(m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*strkv[V])(item.ptr)
+	return kv.k, kv.v, true
+}
+
+// StringMapEntry is a handle to the value for a key within a map, used to insert, update, or remove
+// the value without rehashing the key or repeating the traversal from the root. An entry is
+// invalidated when the map is modified other than through the entry.
+type StringMapEntry[V any] struct {
+	entry
+	kv  *strkv[V]
+	key string
+	hw  maphash.Hash
+}
+
+// Entry returns an entry for key in m.
+func (m StringMap[V]) Entry(key string) (e StringMapEntry[V]) {
+	e.r, e.l, e.key = m.root, &m.link, key
+	e.hw.SetSeed(m.seed)
+	e.hw.WriteString(key)
+	e.h = e.hw.Sum64()
+	e.hd = e.h
+	e.radix = uint8(e.hd & 0xF)
+	for item := e.item(); item != nil; item = e.item() {
+		if e.l.tmap&(1<<e.radix) != 0 { // key-value
+			if kv := (*strkv[V])(item.ptr); kv.k == key {
+				e.kv = kv
+			}
+			return e
+		}
+		if e.descend(item) { // rehash
+			e.hw.WriteString(key)
+			e.hd = e.hw.Sum64()
+		}
+		e.radix = uint8(e.hd & 0xF)
+	}
+	return e
+}
+
+// Exists returns true if the key of e exists in the map.
+func (e *StringMapEntry[V]) Exists() bool { return e.kv != nil }
+
+// Value returns a pointer to the value for the key of e, or nil if the key does not exist.
+func (e *StringMapEntry[V]) Value() *V {
+	if e.kv == nil {
+		return nil
+	}
+	return &e.kv.v
+}
+
+// Insert adds or updates the value for the key of e.
+func (e *StringMapEntry[V]) Insert(value V) {
+	if e.kv != nil { // update existing
+		e.kv.v = value
+		return
+	}
+	if e.stale { // traverse the modified trie
+		*e = StringMap[V]{e.r}.Entry(e.key)
+	}
+	kv := newItem(e.r, strkv[V]{k: e.key, v: value})
+	item := e.item()
+	if item == nil {
+		e.r.insertItem(e.l, e.d, e.radix, e.h, link{ptr: unsafe.Pointer(kv)})
+	} else { // rehash conflicting key
+		ckey := (*strkv[V])(item.ptr).k
+		var chw maphash.Hash
+		chw.SetSeed(e.r.seed)
+		for cd := uint8(0); cd <= e.d; cd += (64 / 4) {
+			chw.WriteString(ckey)
+		}
+		chd := chw.Sum64() >> (4 * (e.d % (64 / 4)))
+		e.r.branchItems(e.l, item, e.d, e.radix, e.h, e.hd, chd, func() (uint64, uint64) {
+			e.hw.WriteString(e.key)
+			chw.WriteString(ckey)
+			return e.hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(kv)})
+	}
+	e.kv, e.stale = kv, true
+}
+
+// Remove deletes the value for the key of e, if the key exists.
+func (e *StringMapEntry[V]) Remove() {
+	if e.stale { // traverse the modified trie
+		*e = StringMap[V]{e.r}.Entry(e.key)
+	}
+	if e.kv == nil {
+		return
+	}
+	if !e.remove() {
+		StringMap[V]{e.r}.Del(e.key)
+	}
+	e.kv = nil
+}
+
+// GetMany looks up the values for keys, storing the value for each key in values at the index
+// of the key, and true in found if found is not nil. Missing keys are assigned the zero value.
+// Keys are hashed and sorted by hash path before walking m once, so links are traversed once for
+// each common prefix. It returns the number of keys found, and panics if values or a non-nil
+// found are shorter than keys.
+func (m StringMap[V]) GetMany(keys []string, values []V, found []bool) (n int) {
+	checkMany("GetMany", len(keys), len(values), found)
+	values = values[:len(keys)]
+	if found != nil {
+		found = found[:len(keys)]
+	}
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.WriteString(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		var v *V
+		if item, _, ok := b.next(bk.path); !ok {
+			v = m.Ptr(key)
+		} else if item != nil {
+			if kv := (*strkv[V])(item.ptr); kv.k == key {
+				v = &kv.v
+			}
+		}
+		if v != nil {
+			values[bk.i] = *v
+			n++
+		} else {
+			var zero V
+			values[bk.i] = zero
+		}
+		if found != nil {
+			found[bk.i] = v != nil
+		}
+	}
+	return n
+}
+
+// SetMany adds or updates the value for each key to the value in values at the index of the key,
+// as if Set were called for each key in order. Keys are hashed and sorted by hash path before
+// walking m once. It panics if values is shorter than keys.
+func (m StringMap[V]) SetMany(keys []string, values []V) {
+	checkMany("SetMany", len(keys), len(values), nil)
+	values = values[:len(keys)]
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.WriteString(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key, value := keys[bk.i], values[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			m.Set(key, value)
+			b.reset()
+			continue
+		}
+		if item == nil {
+			b.insert(d, link{ptr: unsafe.Pointer(newItem(m.root, strkv[V]{k: key, v: value}))})
+			continue
+		}
+		if kv := (*strkv[V])(item.ptr); kv.k == key { // update existing
+			kv.v = value
+			continue
+		}
+		// rehash conflicting key
+		ckey := (*strkv[V])(item.ptr).k
+		var hw, chw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.WriteString(key)
+		chw.SetSeed(m.seed)
+		chw.WriteString(ckey)
+		b.branch(item, d, bk.hash>>(4*d), chw.Sum64()>>(4*d), func() (uint64, uint64) {
+			hw.WriteString(key)
+			chw.WriteString(ckey)
+			return hw.Sum64(), chw.Sum64()
+		}, link{ptr: unsafe.Pointer(newItem(m.root, strkv[V]{k: key, v: value}))})
+	}
+}
+
+// DelMany deletes the values for keys. Keys are hashed and sorted by hash path before walking
+// m once. It returns the number of values deleted.
+func (m StringMap[V]) DelMany(keys []string) (n int) {
+	b := m.newBatch(len(keys), func(i int) uint64 {
+		var hw maphash.Hash
+		hw.SetSeed(m.seed)
+		hw.WriteString(keys[i])
+		return hw.Sum64()
+	})
+	for _, bk := range b.keys {
+		key := keys[bk.i]
+		item, d, ok := b.next(bk.path)
+		if !ok {
+			if _, ok := m.Delete(key); ok {
+				n++
+			}
+			b.reset()
+		} else if item != nil && (*strkv[V])(item.ptr).k == key {
+			b.remove(d)
+			n++
+		}
+	}
+	return n
+}
+
+// itemHash returns the initial hash of the key within the key-value link item.
+func (m StringMap[V]) itemHash(item *link) uint64 {
+	var hw maphash.Hash
+	hw.SetSeed(m.seed)
+	hw.WriteString((*strkv[V])(item.ptr).k)
+	return hw.Sum64()
+}
+
+// RandomKey returns a uniformly random key in m, and false if m is empty. The keys in m are
+// counted by hash prefix in linear time on the first selection, and the counts are maintained as
+// m is modified. Counts are kept for the first k levels, where each sub-trie below the counted
+// levels contains about 16 to 256 keys on average. Later selections descend the counts, then
+// count the keys within the sub-tries along the path below them, so each takes expected time
+// proportional to n/16^k for n keys. If rng is nil, the default source of math/rand is used.
+func (m StringMap[V]) RandomKey(rng *rand.Rand) (key string, ok bool) {
+	item := m.randomItem(rng, m.itemHash)
+	if item == nil {
+		return key, false
+	}
+	return (*strkv[V])(item.ptr).k, true
+}
+
+// Sample returns up to n distinct keys in m, chosen uniformly at random. If n is at most half
+// the length of m, keys are selected as in RandomKey. Otherwise m is scanned once. If rng is
+// nil, the default source of math/rand is used.
+func (m StringMap[V]) Sample(n int, rng *rand.Rand) []string {
+	items := m.sample(n, rng, m.itemHash)
+	keys := make([]string, len(items))
+	for i := range items {
+		item := &items[i]
+		keys[i] = (*strkv[V])(item.ptr).k
+	}
+	return keys
+}
+
+// PopRandom removes a uniformly random key-value from m, returning the key, value, and true
+// if m was not empty. The key-value is selected as in RandomKey, and unlinked through the path
+// traversed during selection. If rng is nil, the default source of math/rand is used.
+func (m StringMap[V]) PopRandom(rng *rand.Rand) (key string, value V, ok bool) {
+	item, ok := m.popRandom(rng, m.itemHash)
+	if !ok {
+		return key, value, false
+	}
+	kv := (*strkv[V])(item.ptr)
+	return kv.k, kv.v, true
+}
@@ -0,0 +1,140 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import "sort"
+
+// Uint64Map maps unsigned integers to values. Keys are stored inline within each leaf link,
+// with the layout and hashing of IntMap[V]. Methods on a map value will panic if the map is
+// not initialized. A map value is safe to copy.
+type Uint64Map[V any] struct {
+	*root
+}
+
+// NewUint64Map returns an initialized map. The map value is safe to copy.
+func NewUint64Map[V any](opts ...Option) Uint64Map[V] {
+	return Uint64Map[V]{newRoot(opts...)}
+}
+
+func (m Uint64Map[V]) ints() IntMap[V] { return IntMap[V]{m.root} }
+
+// Nil returns true if m is not initialized.
+func (m Uint64Map[V]) Nil() bool { return m.root == nil }
+
+// Len returns the number of values in m. If m is not initialized, Len returns 0.
+func (m Uint64Map[V]) Len() uint { return m.root.Len() }
+
+// Dep returns the average (mean) depth of all values in m.
+// If m is not initialized, Dep returns 0.
+func (m Uint64Map[V]) Dep() float64 { return m.root.Dep() }
+
+// Get returns the value for key, or a zero value and false if the key is missing.
+func (m Uint64Map[V]) Get(key uint64) (value V, ok bool) { return m.ints().Get(IntKey(key)) }
+
+// Val returns the value for key, or a zero value if the key is missing or m is not initialized.
+func (m Uint64Map[V]) Val(key uint64) (value V) { return m.ints().Val(IntKey(key)) }
+
+// Ptr returns a pointer to the value for key, or nil if the key is missing.
+// The value may be updated through the returned pointer.
+func (m Uint64Map[V]) Ptr(key uint64) *V { return m.ints().Ptr(IntKey(key)) }
+
+// Set adds or updates the value for key.
+func (m Uint64Map[V]) Set(key uint64, value V) { m.ints().Swap(IntKey(key), value) }
+
+// Swap adds or updates the value for key, returning the previous value and true if
+// key existed.
+func (m Uint64Map[V]) Swap(key uint64, value V) (old V, existed bool) {
+	return m.ints().Swap(IntKey(key), value)
+}
+
+// Mod modifies the value for key using the mod callback. The mod callback receives
+// a pointer to the existing or new value for key, and true if the key existed.
+func (m Uint64Map[V]) Mod(key uint64, mod func(*V, bool)) { m.ints().Mod(IntKey(key), mod) }
+
+// Del deletes the value for key.
+func (m Uint64Map[V]) Del(key uint64) { m.ints().Delete(IntKey(key)) }
+
+// Delete deletes the value for key, returning the deleted value and true if key existed.
+func (m Uint64Map[V]) Delete(key uint64) (old V, existed bool) { return m.ints().Delete(IntKey(key)) }
+
+// GetOrSet returns the existing value for key and true if key exists. Otherwise, it sets
+// and returns value and false.
+func (m Uint64Map[V]) GetOrSet(key uint64, value V) (actual V, loaded bool) {
+	return m.ints().GetOrSet(IntKey(key), value)
+}
+
+// All ranges over values in m, applying the do callback to each value until
+// the callback returns false or all values have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (m Uint64Map[V]) All(do func(uint64, *V) bool) {
+	intScan(&m.link, m.order(), func(k IntKey, v *V) bool { return do(uint64(k), v) })
+}
+
+// SortedAll ranges over values in m in ascending order of keys, applying the do callback
+// to each value until the callback returns false or all values have been visited.
+// Keys are not ordered within a map, so the values of each sub-trie with up to 256 values are
+// ordered by a cursor which buffers its next 32 keys, and cursors are merged through a heap.
+// Memory is used for the cursors rather than for each value in m, and keys are not sorted before
+// the first value is visited. The do callback must not modify m.
+func (m Uint64Map[V]) SortedAll(do func(uint64, *V) bool) {
+	sortedScan(&m.link, m.len, func(a, b *link) int {
+		x, y := uint64(a.pmap)|(uint64(a.tmap)<<32), uint64(b.pmap)|(uint64(b.tmap)<<32)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}, func(item *link) bool {
+		return do(uint64(item.pmap)|(uint64(item.tmap)<<32), &(*intkv[V])(item.ptr).v)
+	})
+}
+
+// SortedKeys returns the keys in m in ascending order.
+func (m Uint64Map[V]) SortedKeys() []uint64 {
+	keys := make([]uint64, 0, m.len)
+	intScan(&m.link, 0, func(k IntKey, _ *V) bool {
+		keys = append(keys, uint64(k))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Clear removes all values from m, retaining the seed of m. If m was initialized with the
+// Recycle option, the link arrays and key-values of m are retained for reuse when values
+// are added, and pointers returned by Ptr must not be used after m is cleared.
+func (m Uint64Map[V]) Clear() { m.ints().Clear() }
+
+// Retain removes the values from m for which the keep callback returns false, in a single
+// pass over m without rehashing keys. The keep callback must not modify m, but may update
+// the value through the given pointer.
+func (m Uint64Map[V]) Retain(keep func(uint64, *V) bool) {
+	m.ints().Retain(func(k IntKey, v *V) bool { return keep(uint64(k), v) })
+}
+
+// KeySet returns a new set containing the keys of m. The new set has the same seed and layout
+// as m, so keys are not rehashed or compared.
+func (m Uint64Map[V]) KeySet() Uint64Set { return Uint64Set{m.ints().KeySet().root} }
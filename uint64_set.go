@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2022 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package amt
+
+import "sort"
+
+// Uint64Set contains a set of unsigned integers. Keys are stored inline within each leaf link,
+// with the layout and hashing of IntSet. Methods on a set value will panic if the set is not
+// initialized. A set value is safe to copy.
+type Uint64Set struct {
+	*root
+}
+
+// NewUint64Set returns an initialized set. The set value is safe to copy.
+func NewUint64Set(opts ...Option) Uint64Set {
+	return Uint64Set{newRoot(opts...)}
+}
+
+func (s Uint64Set) ints() IntSet { return IntSet{s.root} }
+
+// Nil returns true if s is not initialized.
+func (s Uint64Set) Nil() bool { return s.root == nil }
+
+// Len returns the number of keys in s. If s is not initialized, Len returns 0.
+func (s Uint64Set) Len() uint { return s.root.Len() }
+
+// Dep returns the average (mean) depth of all keys in s.
+// If s is not initialized, Dep returns 0.
+func (s Uint64Set) Dep() float64 { return s.root.Dep() }
+
+// Has returns true if s contains key.
+func (s Uint64Set) Has(key uint64) bool { return s.ints().Has(IntKey(key)) }
+
+// Add adds key to s.
+func (s Uint64Set) Add(key uint64) { s.ints().Insert(IntKey(key)) }
+
+// Insert adds key to s, returning true if key was added or false if key existed.
+func (s Uint64Set) Insert(key uint64) bool { return s.ints().Insert(IntKey(key)) }
+
+// Del deletes key from s.
+func (s Uint64Set) Del(key uint64) { s.ints().Remove(IntKey(key)) }
+
+// Remove deletes key from s, returning true if key existed.
+func (s Uint64Set) Remove(key uint64) bool { return s.ints().Remove(IntKey(key)) }
+
+// All ranges over keys in s, applying the do callback to each key until
+// the callback returns false or all keys have been visited. The iteration order
+// is not randomized for each call unless the RandomOrder option was given
+// during initialization.
+func (s Uint64Set) All(do func(uint64) bool) {
+	intSetScan(&s.link, s.order(), func(k IntKey) bool { return do(uint64(k)) })
+}
+
+// SortedKeys returns the keys in s in ascending order.
+func (s Uint64Set) SortedKeys() []uint64 {
+	keys := make([]uint64, 0, s.len)
+	intSetScan(&s.link, 0, func(k IntKey) bool {
+		keys = append(keys, uint64(k))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Clear removes all keys from s, retaining the seed of s. If s was initialized with the
+// Recycle option, the link arrays of s are retained for reuse when keys are added.
+func (s Uint64Set) Clear() { s.ints().Clear() }
+
+// Retain removes the keys from s for which the keep callback returns false, in a single
+// pass over s without rehashing keys. The keep callback must not modify s.
+func (s Uint64Set) Retain(keep func(uint64) bool) {
+	s.ints().Retain(func(k IntKey) bool { return keep(uint64(k)) })
+}
+
+// NewUint64SetFrom returns an initialized set containing the keys in src. Keys are stored inline,
+// so no key-values are allocated. The set value is safe to copy.
+func NewUint64SetFrom(src []uint64, opts ...Option) Uint64Set {
+	s := NewUint64Set(opts...)
+	for _, k := range src {
+		s.Add(k)
+	}
+	return s
+}
+
+// ToSlice returns the keys in s, in the order of All.
+func (s Uint64Set) ToSlice() []uint64 {
+	dst := make([]uint64, 0, s.len)
+	intSetScan(&s.link, s.order(), func(k IntKey) bool {
+		dst = append(dst, uint64(k))
+		return true
+	})
+	return dst
+}